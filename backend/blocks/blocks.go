@@ -0,0 +1,93 @@
+// Package blocks keeps users apart at their own request.
+//
+// A block works both ways: the blocker and the blocked user no longer see
+// each other's posts and comments, cannot reply to or mention each other,
+// and stop following each other. A mute only works for the user who set
+// it: the muted user's content is left out of everything they read, and the
+// muted user is not told.
+package blocks
+
+import (
+    "time"
+
+    "github.com/elham-abdu/cyberbullyprevention/models"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+)
+
+// Entry is a user on someone's block or mute list
+type Entry struct {
+    UserID    uint      `json:"user_id"`
+    Username  *string   `json:"username"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// Between reports whether either user blocked the other
+func Between(db *gorm.DB, userID, otherID uint) (bool, error) {
+    var blocks int64
+    err := db.Model(&models.Block{}).
+        Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)", userID, otherID, otherID, userID).
+        Count(&blocks).Error
+    return blocks > 0, err
+}
+
+// Hidden selects the IDs of the users whose content viewerID does not see:
+// users blocked either way and users viewerID muted. It is meant as a
+// subquery, e.g. Where("user_id NOT IN (?)", blocks.Hidden(db, viewerID)).
+func Hidden(db *gorm.DB, viewerID uint) *gorm.DB {
+    return db.Raw(`SELECT blocked_id FROM blocks WHERE blocker_id = ?
+        UNION SELECT blocker_id FROM blocks WHERE blocked_id = ?
+        UNION SELECT muted_id FROM mutes WHERE muter_id = ?`, viewerID, viewerID, viewerID)
+}
+
+// Block makes blockerID and blockedID invisible to each other and ends
+// their follows. Blocking someone twice changes nothing.
+func Block(tx *gorm.DB, blockerID, blockedID uint) error {
+    block := models.Block{BlockerID: blockerID, BlockedID: blockedID}
+    if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&block).Error; err != nil {
+        return err
+    }
+    return tx.Where("(follower_id = ? AND followee_id = ?) OR (follower_id = ? AND followee_id = ?)", blockerID, blockedID, blockedID, blockerID).
+        Delete(&models.Follow{}).Error
+}
+
+// Unblock lifts a block. Follows ended by the block stay ended.
+func Unblock(db *gorm.DB, blockerID, blockedID uint) error {
+    return db.Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).Delete(&models.Block{}).Error
+}
+
+// Mute hides mutedID's content from muterID. Muting someone twice changes
+// nothing.
+func Mute(db *gorm.DB, muterID, mutedID uint) error {
+    mute := models.Mute{MuterID: muterID, MutedID: mutedID}
+    return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&mute).Error
+}
+
+// Unmute shows mutedID's content to muterID again
+func Unmute(db *gorm.DB, muterID, mutedID uint) error {
+    return db.Where("muter_id = ? AND muted_id = ?", muterID, mutedID).Delete(&models.Mute{}).Error
+}
+
+// Blocked lists the users blockerID blocked, most recent first
+func Blocked(db *gorm.DB, blockerID uint) ([]Entry, error) {
+    entries := []Entry{}
+    err := db.Model(&models.Block{}).
+        Select("blocks.blocked_id AS user_id, users.username, blocks.created_at").
+        Joins("JOIN users ON users.id = blocks.blocked_id").
+        Where("blocks.blocker_id = ?", blockerID).
+        Order("blocks.created_at DESC").
+        Scan(&entries).Error
+    return entries, err
+}
+
+// Muted lists the users muterID muted, most recent first
+func Muted(db *gorm.DB, muterID uint) ([]Entry, error) {
+    entries := []Entry{}
+    err := db.Model(&models.Mute{}).
+        Select("mutes.muted_id AS user_id, users.username, mutes.created_at").
+        Joins("JOIN users ON users.id = mutes.muted_id").
+        Where("mutes.muter_id = ?", muterID).
+        Order("mutes.created_at DESC").
+        Scan(&entries).Error
+    return entries, err
+}
@@ -20,3 +20,12 @@ func GetEnv(key string) string {
     }
     return value
 }
+
+// GetEnvOrDefault returns the value of key, or fallback when it is not set
+func GetEnvOrDefault(key, fallback string) string {
+    value := os.Getenv(key)
+    if value == "" {
+        return fallback
+    }
+    return value
+}
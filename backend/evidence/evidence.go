@@ -0,0 +1,341 @@
+// Package evidence builds case bundles for serious incidents.
+//
+// A case covers every post and comment of one user, or a chosen set of
+// posts with the comments on them, with the original content, all
+// revisions, every analysis and the moderation actions taken. Export
+// writes it as a ZIP of JSON files and a readable HTML report, plus a
+// manifest of SHA-256 digests. The digest of the manifest itself is
+// returned so it can be kept apart from the bundle; changing any file then
+// shows up as a mismatch.
+package evidence
+
+import (
+    "archive/zip"
+    "bytes"
+    "crypto/sha256"
+    "embed"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "html/template"
+    "io"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/elham-abdu/cyberbullyprevention/models"
+    "github.com/elham-abdu/cyberbullyprevention/services"
+    "gorm.io/gorm"
+)
+
+//go:embed report.html
+var templates embed.FS
+
+// report is the human-readable view of a case
+var report = template.Must(template.New("report.html").Funcs(template.FuncMap{
+    "when":   func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04:05 MST") },
+    "result": decodeResult,
+}).ParseFS(templates, "report.html"))
+
+// Scope selects what a case covers: all posts of UserID, or the posts in
+// PostIDs
+type Scope struct {
+    UserID  uint   `json:"user_id,omitempty"`
+    PostIDs []uint `json:"post_ids,omitempty"`
+}
+
+// Person is a user involved in a case. Credentials are never exported.
+type Person struct {
+    ID        uint      `json:"id"`
+    Email     string    `json:"email"`
+    Role      string    `json:"role"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// PostRecord is everything known about one post
+type PostRecord struct {
+    Post models.Post `json:"post"`
+    // Original is the content as first written
+    Original  string                    `json:"original_content"`
+    Revisions []models.PostRevision     `json:"revisions"`
+    Analyses  []models.PostAnalysis     `json:"analyses"`
+    Actions   []models.ModerationAction `json:"moderation_actions"`
+}
+
+// CommentRecord is everything known about one comment. Comments keep no
+// revisions; the moderation actions hold the content as it was when each
+// decision was taken.
+type CommentRecord struct {
+    Comment  models.Comment            `json:"comment"`
+    Analyses []models.PostAnalysis     `json:"analyses"`
+    Actions  []models.ModerationAction `json:"moderation_actions"`
+}
+
+// Case is a collected evidence package
+type Case struct {
+    ID          string                    `json:"case_id"`
+    GeneratedAt time.Time                 `json:"generated_at"`
+    GeneratedBy uint                      `json:"generated_by"`
+    Scope       Scope                     `json:"scope"`
+    People      []Person                  `json:"people"`
+    PostIDs     []uint                    `json:"post_ids"`
+    CommentIDs  []uint                    `json:"comment_ids"`
+    Posts       []PostRecord              `json:"-"`
+    Comments    []CommentRecord           `json:"-"`
+    Actions     []models.ModerationAction `json:"-"`
+}
+
+// ManifestEntry is the digest of one file in a bundle
+type ManifestEntry struct {
+    Name   string `json:"name"`
+    SHA256 string `json:"sha256"`
+    Size   int    `json:"size"`
+}
+
+// Manifest lists every file of a bundle with its digest
+type Manifest struct {
+    CaseID      string          `json:"case_id"`
+    GeneratedAt time.Time       `json:"generated_at"`
+    Algorithm   string          `json:"algorithm"`
+    Files       []ManifestEntry `json:"files"`
+}
+
+// Collect gathers the case for scope. Deleted posts and comments are
+// included.
+func Collect(db *gorm.DB, scope Scope, actorID uint, now time.Time) (*Case, error) {
+    query := db.Unscoped().Order("created_at ASC, id ASC")
+    if scope.UserID != 0 {
+        query = query.Where("user_id = ?", scope.UserID)
+    } else {
+        query = query.Where("id IN ?", scope.PostIDs)
+    }
+    var posts []models.Post
+    if err := query.Find(&posts).Error; err != nil {
+        return nil, err
+    }
+
+    c := &Case{
+        ID:          caseID(scope, now),
+        GeneratedAt: now.UTC(),
+        GeneratedBy: actorID,
+        Scope:       scope,
+    }
+
+    authors := map[uint]bool{}
+    if scope.UserID != 0 {
+        authors[scope.UserID] = true
+    }
+    postIDs := make([]uint, 0, len(posts))
+    for _, post := range posts {
+        authors[post.UserID] = true
+        postIDs = append(postIDs, post.ID)
+
+        record := PostRecord{Post: post, Original: post.Content}
+        if err := db.Where("post_id = ?", post.ID).Order("created_at ASC, id ASC").Find(&record.Revisions).Error; err != nil {
+            return nil, err
+        }
+        if err := db.Where("post_id = ? AND comment_id IS NULL", post.ID).Order("created_at ASC, id ASC").Find(&record.Analyses).Error; err != nil {
+            return nil, err
+        }
+        if err := db.Where("post_id = ?", post.ID).Order("created_at ASC, id ASC").Find(&record.Actions).Error; err != nil {
+            return nil, err
+        }
+        if len(record.Revisions) > 0 {
+            record.Original = record.Revisions[0].Content
+        }
+        c.Posts = append(c.Posts, record)
+    }
+
+    // The user's own comments, or every comment on the chosen posts
+    commentQuery := db.Unscoped().Order("created_at ASC, id ASC")
+    if scope.UserID != 0 {
+        commentQuery = commentQuery.Where("user_id = ?", scope.UserID)
+    } else {
+        commentQuery = commentQuery.Where("post_id IN ?", postIDs)
+    }
+    var comments []models.Comment
+    if err := commentQuery.Find(&comments).Error; err != nil {
+        return nil, err
+    }
+
+    commentIDs := make([]uint, 0, len(comments))
+    for _, comment := range comments {
+        authors[comment.UserID] = true
+        commentIDs = append(commentIDs, comment.ID)
+
+        record := CommentRecord{Comment: comment}
+        if err := db.Where("comment_id = ?", comment.ID).Order("created_at ASC, id ASC").Find(&record.Analyses).Error; err != nil {
+            return nil, err
+        }
+        if err := db.Where("comment_id = ?", comment.ID).Order("created_at ASC, id ASC").Find(&record.Actions).Error; err != nil {
+            return nil, err
+        }
+        c.Comments = append(c.Comments, record)
+    }
+
+    // Every action on the posts and comments, and for a user case every
+    // action about them
+    actions := db.Order("created_at ASC, id ASC")
+    if scope.UserID != 0 {
+        actions = actions.Where("post_id IN ? OR comment_id IN ? OR target_user_id = ?", postIDs, commentIDs, scope.UserID)
+    } else {
+        actions = actions.Where("post_id IN ? OR comment_id IN ?", postIDs, commentIDs)
+    }
+    if err := actions.Find(&c.Actions).Error; err != nil {
+        return nil, err
+    }
+
+    c.PostIDs = postIDs
+    c.CommentIDs = commentIDs
+
+    ids := make([]uint, 0, len(authors))
+    for id := range authors {
+        ids = append(ids, id)
+    }
+    var users []models.User
+    if err := db.Where("id IN ?", ids).Order("id ASC").Find(&users).Error; err != nil {
+        return nil, err
+    }
+    for _, user := range users {
+        c.People = append(c.People, Person{ID: user.ID, Email: user.Email, Role: user.Role, CreatedAt: user.CreatedAt})
+    }
+    return c, nil
+}
+
+// Hold puts the posts and comments of the case under legal hold, so the
+// retention job never purges what an exported bundle points at
+func Hold(db *gorm.DB, c *Case) error {
+    if len(c.PostIDs) > 0 {
+        err := db.Unscoped().Model(&models.Post{}).Where("id IN ?", c.PostIDs).UpdateColumn("legal_hold", true).Error
+        if err != nil {
+            return err
+        }
+    }
+    if len(c.CommentIDs) > 0 {
+        return db.Unscoped().Model(&models.Comment{}).Where("id IN ?", c.CommentIDs).UpdateColumn("legal_hold", true).Error
+    }
+    return nil
+}
+
+// Export writes the case to w as a ZIP bundle and returns the hex SHA-256
+// of its manifest
+func Export(w io.Writer, c *Case) (string, error) {
+    files, err := render(c)
+    if err != nil {
+        return "", err
+    }
+
+    manifest := Manifest{CaseID: c.ID, GeneratedAt: c.GeneratedAt, Algorithm: "SHA-256"}
+    var sums strings.Builder
+    for _, file := range files {
+        sum := sha256.Sum256(file.data)
+        digest := hex.EncodeToString(sum[:])
+        manifest.Files = append(manifest.Files, ManifestEntry{Name: file.name, SHA256: digest, Size: len(file.data)})
+        // sha256sum -c format
+        fmt.Fprintf(&sums, "%s  %s\n", digest, file.name)
+    }
+    manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+    if err != nil {
+        return "", err
+    }
+    files = append(files,
+        bundleFile{"manifest.json", manifestJSON},
+        bundleFile{"SHA256SUMS", []byte(sums.String())},
+    )
+
+    archive := zip.NewWriter(w)
+    for _, file := range files {
+        entry, err := archive.CreateHeader(&zip.FileHeader{
+            Name:     c.ID + "/" + file.name,
+            Method:   zip.Deflate,
+            Modified: c.GeneratedAt,
+        })
+        if err != nil {
+            return "", err
+        }
+        if _, err := entry.Write(file.data); err != nil {
+            return "", err
+        }
+    }
+    if err := archive.Close(); err != nil {
+        return "", err
+    }
+
+    sum := sha256.Sum256(manifestJSON)
+    return hex.EncodeToString(sum[:]), nil
+}
+
+// Report writes the human-readable HTML report of the case
+func Report(w io.Writer, c *Case) error {
+    return report.Execute(w, c)
+}
+
+// bundleFile is one file of a bundle
+type bundleFile struct {
+    name string
+    data []byte
+}
+
+// render turns the case into the files of its bundle
+func render(c *Case) ([]bundleFile, error) {
+    var files []bundleFile
+    add := func(name string, value interface{}) error {
+        data, err := json.MarshalIndent(value, "", "  ")
+        if err != nil {
+            return err
+        }
+        files = append(files, bundleFile{name, data})
+        return nil
+    }
+
+    if err := add("case.json", c); err != nil {
+        return nil, err
+    }
+    for _, record := range c.Posts {
+        if err := add(fmt.Sprintf("posts/post-%d.json", record.Post.ID), record); err != nil {
+            return nil, err
+        }
+    }
+    for _, record := range c.Comments {
+        if err := add(fmt.Sprintf("comments/comment-%d.json", record.Comment.ID), record); err != nil {
+            return nil, err
+        }
+    }
+    if err := add("moderation_actions.json", c.Actions); err != nil {
+        return nil, err
+    }
+
+    var html bytes.Buffer
+    if err := Report(&html, c); err != nil {
+        return nil, err
+    }
+    files = append(files, bundleFile{"report.html", html.Bytes()})
+    return files, nil
+}
+
+// decodeResult reads the pipeline result stored with an analysis. An
+// unreadable result shows up as an empty one.
+func decodeResult(data json.RawMessage) services.ToxicityResult {
+    var result services.ToxicityResult
+    json.Unmarshal(data, &result)
+    return result
+}
+
+// caseID names a case after its scope and the time it was generated
+func caseID(scope Scope, now time.Time) string {
+    stamp := now.UTC().Format("20060102T150405Z")
+    if scope.UserID != 0 {
+        return fmt.Sprintf("case-user-%d-%s", scope.UserID, stamp)
+    }
+    ids := append([]uint(nil), scope.PostIDs...)
+    sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+    parts := make([]string, len(ids))
+    for i, id := range ids {
+        parts[i] = fmt.Sprint(id)
+    }
+    name := strings.Join(parts, "-")
+    if len(ids) > 5 {
+        name = fmt.Sprintf("%s-and-%d-more", strings.Join(parts[:5], "-"), len(ids)-5)
+    }
+    return fmt.Sprintf("case-posts-%s-%s", name, stamp)
+}
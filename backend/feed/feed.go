@@ -0,0 +1,169 @@
+// Package feed pages through the posts a user may see.
+//
+// The global feed holds every visible post, the following feed the posts of
+// the users the viewer follows and a profile the posts of one user, all
+// newest first. Posts of others are visible once published; authors also
+// see their own posts while they are held for review or shadow-hidden.
+// Rejected and removed posts never show up, and neither do the posts of
+// users on either side of a block or muted by the viewer. Flagged posts by
+// others carry a warning and are collapsed, their content left out, unless
+// the viewer asks to see them.
+//
+// Pages are cut with an opaque cursor naming the last post of the previous
+// page, so posts created while a user scrolls do not shift the pages.
+package feed
+
+import (
+    "encoding/base64"
+    "errors"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/elham-abdu/cyberbullyprevention/blocks"
+    "github.com/elham-abdu/cyberbullyprevention/models"
+    "gorm.io/gorm"
+)
+
+const (
+    // DefaultLimit is the page size when none is asked for
+    DefaultLimit = 20
+    // MaxLimit caps the page size
+    MaxLimit = 100
+)
+
+// ErrBadCursor is returned for cursors this package did not hand out
+var ErrBadCursor = errors.New("invalid cursor")
+
+// Options describe the page a viewer asks for
+type Options struct {
+    ViewerID uint
+    // Limit is the page size, DefaultLimit when 0
+    Limit int
+    // Cursor is the NextCursor of the previous page, empty for the first
+    Cursor string
+    // ShowFlagged expands flagged posts instead of collapsing them
+    ShowFlagged bool
+}
+
+// Entry is a post in a feed. Collapsed posts come without their content.
+type Entry struct {
+    Post      models.Post `json:"post"`
+    Collapsed bool        `json:"collapsed"`
+    Warning   string      `json:"warning,omitempty"`
+}
+
+// Page is one page of a feed. NextCursor is empty on the last page.
+type Page struct {
+    Entries    []Entry `json:"entries"`
+    NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// warnings are shown over flagged posts by severity
+var warnings = map[string]string{
+    "critical": "This post was flagged as severely harmful and may be distressing.",
+    "high":     "This post was flagged as harmful and may be upsetting.",
+}
+
+// defaultWarning is shown over flagged posts of lower severity
+const defaultWarning = "This post was flagged as potentially harmful."
+
+// Global returns a page of every post the viewer may see
+func Global(db *gorm.DB, opts Options) (*Page, error) {
+    return page(Visible(db, opts.ViewerID), opts)
+}
+
+// Following returns a page of the posts of the users the viewer follows
+func Following(db *gorm.DB, opts Options) (*Page, error) {
+    followed := db.Model(&models.Follow{}).Select("followee_id").Where("follower_id = ?", opts.ViewerID)
+    return page(Visible(db, opts.ViewerID).Where("user_id IN (?)", followed), opts)
+}
+
+// Profile returns a page of the posts of one user
+func Profile(db *gorm.DB, opts Options, authorID uint) (*Page, error) {
+    return page(Visible(db, opts.ViewerID).Where("user_id = ?", authorID), opts)
+}
+
+// Visible selects the posts viewerID may see
+func Visible(db *gorm.DB, viewerID uint) *gorm.DB {
+    own := []string{models.PostPendingReview, models.PostHidden}
+    return db.Model(&models.Post{}).
+        Where("state = ? OR (user_id = ? AND state IN ?)", models.PostPublished, viewerID, own).
+        Where("user_id NOT IN (?)", blocks.Hidden(db, viewerID))
+}
+
+// page reads the page of query that opts ask for
+func page(query *gorm.DB, opts Options) (*Page, error) {
+    limit := opts.Limit
+    if limit <= 0 || limit > MaxLimit {
+        limit = DefaultLimit
+    }
+    if opts.Cursor != "" {
+        createdAt, id, err := decodeCursor(opts.Cursor)
+        if err != nil {
+            return nil, err
+        }
+        query = query.Where("(created_at, id) < (?, ?)", createdAt, id)
+    }
+
+    var posts []models.Post
+    if err := query.Order("created_at DESC, id DESC").Limit(limit + 1).Find(&posts).Error; err != nil {
+        return nil, err
+    }
+
+    result := &Page{Entries: make([]Entry, 0, len(posts))}
+    if len(posts) > limit {
+        posts = posts[:limit]
+        last := posts[limit-1]
+        result.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+    }
+    for _, post := range posts {
+        result.Entries = append(result.Entries, entry(post, opts))
+    }
+    return result, nil
+}
+
+// entry puts a post behind a warning when it is flagged and not the
+// viewer's own
+func entry(post models.Post, opts Options) Entry {
+    item := Entry{Post: post}
+    if !post.IsFlagged || post.UserID == opts.ViewerID {
+        return item
+    }
+    item.Warning = defaultWarning
+    if warning, ok := warnings[post.Severity]; ok {
+        item.Warning = warning
+    }
+    if !opts.ShowFlagged {
+        item.Collapsed = true
+        item.Post.Content = ""
+    }
+    return item
+}
+
+// encodeCursor names a post by its creation time and ID
+func encodeCursor(createdAt time.Time, id uint) string {
+    raw := strconv.FormatInt(createdAt.UnixNano(), 10) + ":" + strconv.FormatUint(uint64(id), 10)
+    return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor reads a cursor made by encodeCursor
+func decodeCursor(cursor string) (time.Time, uint, error) {
+    raw, err := base64.RawURLEncoding.DecodeString(cursor)
+    if err != nil {
+        return time.Time{}, 0, ErrBadCursor
+    }
+    nanos, id, found := strings.Cut(string(raw), ":")
+    if !found {
+        return time.Time{}, 0, ErrBadCursor
+    }
+    unixNanos, err := strconv.ParseInt(nanos, 10, 64)
+    if err != nil {
+        return time.Time{}, 0, ErrBadCursor
+    }
+    postID, err := strconv.ParseUint(id, 10, 64)
+    if err != nil {
+        return time.Time{}, 0, ErrBadCursor
+    }
+    return time.Unix(0, unixNanos), uint(postID), nil
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/elham-abdu/cyberbullyprevention/models"
+	"github.com/elham-abdu/cyberbullyprevention/policy"
+	"github.com/elham-abdu/cyberbullyprevention/services"
+	"gorm.io/gorm"
+)
+
+// applyAnalysis copies the summary fields of a result onto a post
+func applyAnalysis(post *models.Post, result *services.ToxicityResult) {
+	post.ToxicityScore = int(result.Score)
+	post.IsFlagged = result.IsFlagged
+	post.Severity = result.Severity
+	post.Sentiment = result.Sentiment
+	if result.Policy != nil {
+		post.PolicyAction = string(result.Policy.Action)
+	}
+}
+
+// rejectedByPolicy answers with 422 and the reasons when the moderation
+// policy rejects content, and reports whether it did
+func rejectedByPolicy(w http.ResponseWriter, content string, result *services.ToxicityResult) bool {
+	if result.Policy == nil || result.Policy.Action != policy.ActionReject {
+		return false
+	}
+
+	notifyPolicy("rejected content", result)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":       "Content rejected by the moderation policy",
+		"analysis":    result,
+		"nudges":      services.Nudges(result),
+		"rephrasings": services.SuggestRephrasings(content, result),
+	})
+	return true
+}
+
+// notifies reports whether a policy rule that asks for moderators to be
+// told fired on the result. Saved content is then queued for review with a
+// higher priority and marked in the queue.
+func notifies(result *services.ToxicityResult) bool {
+	return result.Policy != nil && result.Policy.Notify
+}
+
+// notifyPolicy logs content that fired a notifying policy rule, including
+// rejected content that is never saved. subject names it in the log, e.g.
+// "post 12".
+func notifyPolicy(subject string, result *services.ToxicityResult) {
+	if !notifies(result) {
+		return
+	}
+	log.Printf("Moderation policy v%d: %s for %s (rules: %v)",
+		result.Policy.PolicyVersion, result.Policy.Action, subject, result.Policy.Matched)
+}
+
+// newPostAnalysis builds a PostAnalysis row from a pipeline result
+func newPostAnalysis(postID uint, result *services.ToxicityResult) (models.PostAnalysis, error) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return models.PostAnalysis{}, err
+	}
+	return models.PostAnalysis{
+		PostID:          postID,
+		Provider:        result.Provider,
+		ProviderVersion: result.ProviderVersion,
+		LatencyMs:       result.LatencyMs,
+		Score:           result.Score,
+		IsFlagged:       result.IsFlagged,
+		Severity:        result.Severity,
+		Sentiment:       result.Sentiment,
+		Confidence:      result.Confidence,
+		Result:          data,
+	}, nil
+}
+
+// saveAnalysis stores the full pipeline result for a post
+func saveAnalysis(tx *gorm.DB, postID uint, result *services.ToxicityResult) (*models.PostAnalysis, error) {
+	analysis, err := newPostAnalysis(postID, result)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&analysis).Error; err != nil {
+		return nil, err
+	}
+	return &analysis, nil
+}
+
+// saveCommentAnalysis stores the full pipeline result for a comment
+func saveCommentAnalysis(tx *gorm.DB, comment *models.Comment, result *services.ToxicityResult) error {
+	analysis, err := newPostAnalysis(comment.PostID, result)
+	if err != nil {
+		return err
+	}
+	analysis.CommentID = &comment.ID
+	return tx.Create(&analysis).Error
+}
+
+// withAnalyses preloads post analyses when the request asks for them
+// with ?include=analysis
+func withAnalyses(db *gorm.DB, r *http.Request) *gorm.DB {
+	if r.URL.Query().Get("include") != "analysis" {
+		return db
+	}
+	return db.Preload("Analyses", func(db *gorm.DB) *gorm.DB {
+		return db.Where("comment_id IS NULL").Order("created_at DESC")
+	})
+}
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/elham-abdu/cyberbullyprevention/config"
+	"github.com/elham-abdu/cyberbullyprevention/models"
+	"github.com/elham-abdu/cyberbullyprevention/moderation"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxAppealLength caps the length of an appeal statement, in characters
+const maxAppealLength = 2000
+
+// contestedActions are the moderator actions an appeal can be about
+var contestedActions = []string{
+	models.ActionHold,
+	models.ActionHide,
+	models.ActionReject,
+	models.ActionRemove,
+}
+
+var (
+	// errAppealDecided is returned when an appeal was already reviewed
+	errAppealDecided = errors.New("appeal already decided")
+	// errSameModerator is returned when the original decision-maker, or the
+	// author, tries to review an appeal
+	errSameModerator = errors.New("appeals must be reviewed by a different moderator")
+)
+
+// appealable reports whether a post carries a moderation decision its
+// author can contest
+func appealable(post *models.Post) bool {
+	switch post.State {
+	case models.PostPendingReview, models.PostHidden, models.PostRejected, models.PostRemoved:
+		return true
+	}
+	return post.IsFlagged
+}
+
+// CreateAppeal lets an author contest the moderation decision on one of
+// their posts with a statement
+func CreateAppeal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		PostID    uint   `json:"post_id"`
+		Statement string `json:"statement"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	input.Statement = strings.TrimSpace(input.Statement)
+	if input.Statement == "" {
+		http.Error(w, "Statement is required", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(input.Statement) > maxAppealLength {
+		http.Error(w, "Statement is too long", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(uint)
+
+	// Removed posts are soft-deleted but can still be appealed; posts the
+	// author deleted themselves cannot
+	var post models.Post
+	err := config.DB.Unscoped().Where("user_id = ?", userID).First(&post, input.PostID).Error
+	if err != nil || (post.DeletedAt.Valid && post.State != models.PostRemoved) {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if !appealable(&post) {
+		http.Error(w, "There is no moderation decision to appeal", http.StatusConflict)
+		return
+	}
+
+	var pending int64
+	config.DB.Model(&models.Appeal{}).Where("post_id = ? AND status = ?", post.ID, models.AppealPending).Count(&pending)
+	if pending > 0 {
+		http.Error(w, "This post already has a pending appeal", http.StatusConflict)
+		return
+	}
+
+	appeal := models.Appeal{
+		PostID:    post.ID,
+		UserID:    userID,
+		Statement: input.Statement,
+		Status:    models.AppealPending,
+	}
+
+	var contested models.ModerationAction
+	result := config.DB.Where("post_id = ? AND action IN ?", post.ID, contestedActions).
+		Order("created_at DESC, id DESC").
+		Limit(1).Find(&contested)
+	if result.Error != nil {
+		http.Error(w, "Error saving appeal", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected > 0 {
+		appeal.ActionID = &contested.ID
+		appeal.DecidedBy = contested.ActorID
+	}
+
+	if err := config.DB.Create(&appeal).Error; err != nil {
+		http.Error(w, "Error saving appeal", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(appeal)
+}
+
+// GetMyAppeals lists the caller's appeals, newest first
+func GetMyAppeals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(uint)
+	var appeals []models.Appeal
+	err := config.DB.Preload("Post", func(tx *gorm.DB) *gorm.DB { return tx.Unscoped() }).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&appeals).Error
+	if err != nil {
+		http.Error(w, "Error fetching appeals", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(appeals)
+}
+
+// GetAppeals is the appeals queue. By default it lists the pending appeals
+// the caller may review, oldest first; ?status=upheld or overturned lists
+// decided ones, newest first.
+func GetAppeals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.AppealPending
+	}
+
+	query := config.DB.Preload("Post", func(tx *gorm.DB) *gorm.DB { return tx.Unscoped() }).
+		Where("status = ?", status)
+	if status == models.AppealPending {
+		moderatorID := r.Context().Value("user_id").(uint)
+		query = query.Where("decided_by <> ? AND user_id <> ?", moderatorID, moderatorID).Order("created_at ASC")
+	} else {
+		query = query.Order("reviewed_at DESC")
+	}
+
+	var appeals []models.Appeal
+	if err := query.Find(&appeals).Error; err != nil {
+		http.Error(w, "Error fetching appeals", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(appeals)
+}
+
+// DecideAppeal upholds or overturns an appeal. Overturning publishes the
+// post and clears its flag; upholding keeps the decision. Either outcome is
+// recorded in the audit log.
+func DecideAppeal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		AppealID   uint   `json:"appeal_id"`
+		Outcome    string `json:"outcome"`
+		Note       string `json:"note"`
+		ReasonCode string `json:"reason_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if input.Outcome != models.AppealUpheld && input.Outcome != models.AppealOverturned {
+		http.Error(w, "Outcome must be upheld or overturned", http.StatusBadRequest)
+		return
+	}
+
+	reviewerID := r.Context().Value("user_id").(uint)
+	var appeal models.Appeal
+	var post models.Post
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&appeal, input.AppealID).Error; err != nil {
+			return err
+		}
+		if appeal.Status != models.AppealPending {
+			return errAppealDecided
+		}
+		if reviewerID == appeal.DecidedBy || reviewerID == appeal.UserID {
+			return errSameModerator
+		}
+		if err := tx.Unscoped().First(&post, appeal.PostID).Error; err != nil {
+			return err
+		}
+
+		if input.Outcome == models.AppealOverturned {
+			decision := moderationDecision{
+				Action:     models.ActionAppealOverturned,
+				State:      models.PostPublished,
+				ReasonCode: input.ReasonCode,
+				Note:       input.Note,
+			}
+			if err := transitionPost(tx, &post, decision, reviewerID); err != nil {
+				return err
+			}
+		} else {
+			// An upheld appeal keeps the reason of the contested action
+			reasonCode := input.ReasonCode
+			if reasonCode == "" && appeal.ActionID != nil {
+				var contested models.ModerationAction
+				if err := tx.First(&contested, *appeal.ActionID).Error; err != nil {
+					return err
+				}
+				reasonCode = contested.ReasonCode
+			} else if err := checkReason(tx, moderationDecision{ReasonCode: reasonCode}); err != nil {
+				return err
+			}
+			_, err := moderation.Record(tx, &post, models.ModerationAction{
+				ActorID:    reviewerID,
+				Action:     models.ActionAppealUpheld,
+				ReasonCode: reasonCode,
+				Note:       input.Note,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		appeal.Status = input.Outcome
+		appeal.ReviewerID = &reviewerID
+		appeal.ReviewNote = input.Note
+		appeal.ReviewedAt = &now
+		return tx.Save(&appeal).Error
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "Appeal not found", http.StatusNotFound)
+		return
+	case errors.Is(err, errAppealDecided):
+		http.Error(w, "Appeal already decided", http.StatusConflict)
+		return
+	case errors.Is(err, errSameModerator):
+		http.Error(w, "Appeals must be reviewed by a different moderator", http.StatusForbidden)
+		return
+	default:
+		writeTransitionError(w, err, "Post", post.State, models.PostPublished)
+		return
+	}
+
+	appeal.Post = &post
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(appeal)
+}
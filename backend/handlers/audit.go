@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/elham-abdu/cyberbullyprevention/config"
+	"github.com/elham-abdu/cyberbullyprevention/moderation"
+)
+
+// GetModerationAudit lists recorded moderation actions, newest first.
+// Filters: ?actor_id=, ?action=, ?post_id=, ?comment_id=, ?user_id= (the
+// target user), ?from= and ?to= as RFC 3339 times or YYYY-MM-DD dates (to
+// is inclusive for dates), and ?limit= (default 100, at most 500).
+func GetModerationAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := moderation.AuditFilter{Action: query.Get("action"), Limit: 100}
+
+	ids := map[string]*uint{
+		"actor_id":   &filter.ActorID,
+		"post_id":    &filter.PostID,
+		"comment_id": &filter.CommentID,
+		"user_id":    &filter.TargetUserID,
+	}
+	for name, target := range ids {
+		if query.Get(name) == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(query.Get(name), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid "+name, http.StatusBadRequest)
+			return
+		}
+		*target = uint(id)
+	}
+
+	var err error
+	if filter.From, err = parseAuditTime(query.Get("from"), false); err != nil {
+		http.Error(w, "Invalid from date", http.StatusBadRequest)
+		return
+	}
+	if filter.To, err = parseAuditTime(query.Get("to"), true); err != nil {
+		http.Error(w, "Invalid to date", http.StatusBadRequest)
+		return
+	}
+
+	if limit, err := strconv.Atoi(query.Get("limit")); err == nil && limit > 0 && limit <= 500 {
+		filter.Limit = limit
+	}
+
+	actions, err := moderation.Audit(config.DB, filter)
+	if err != nil {
+		http.Error(w, "Error fetching audit log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(actions)
+}
+
+// parseAuditTime reads an RFC 3339 time or a plain date. A date used as the
+// end of a range covers the whole day.
+func parseAuditTime(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
@@ -1,13 +1,18 @@
-package handlers
+﻿package handlers
 import (
 	"net/http"
 	"github.com/elham-abdu/cyberbullyprevention/config"
+	"github.com/elham-abdu/cyberbullyprevention/harassment"
 	"github.com/elham-abdu/cyberbullyprevention/models"
+	"github.com/elham-abdu/cyberbullyprevention/moderation"
 	"github.com/elham-abdu/cyberbullyprevention/utils"
     "github.com/elham-abdu/cyberbullyprevention/services"
 	"encoding/json"
+	"errors"
+	"fmt"
     "time"
     "github.com/golang-jwt/jwt/v5"
+    "gorm.io/gorm"
     "log"
 	
 )
@@ -20,6 +25,7 @@ func Register(w http.ResponseWriter, r *http.Request) {
     type RegisterInput struct {
         Email    string `json:"email"`
         Password string `json:"password"`
+        Username string `json:"username"`
     }
 
     var input RegisterInput
@@ -41,6 +47,16 @@ func Register(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    var username *string
+    if input.Username != "" {
+        checked, err := checkUsername(input.Username, 0)
+        if err != nil {
+            writeUsernameError(w, err)
+            return
+        }
+        username = &checked
+    }
+
     hashedPassword, err := utils.HashPassword(input.Password)
     if err != nil {
         http.Error(w, "Error hashing password", http.StatusInternalServerError)
@@ -49,6 +65,7 @@ func Register(w http.ResponseWriter, r *http.Request) {
 
     user := models.User{
         Email:        input.Email,
+        Username:     username,
         PasswordHash: hashedPassword,
         Role:         "user",
     }
@@ -131,14 +148,17 @@ func Me(w http.ResponseWriter, r *http.Request) {
 
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(map[string]interface{}{
-        "user_id": user.ID,
-        "email":   user.Email,
-        "role":    role,
+        "user_id":  user.ID,
+        "email":    user.Email,
+        "username": user.Username,
+        "role":     role,
     })
 }
 
 type CreatePostInput struct {
-    Content string `json:"content"`
+    Content   string `json:"content"`
+    // ReplyToID is the post being answered, if any
+    ReplyToID *uint `json:"reply_to_id"`
 }
 func CreatePost(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -158,67 +178,125 @@ func CreatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// ✅ Analyze toxicity using IBM ML model
-	result, err := services.AnalyzeToxicityWithIBM(input.Content)
+	userID := r.Context().Value("user_id").(uint)
+	replyTo, err := replyTarget(input.ReplyToID, userID)
+	if errors.Is(err, errNoReplyTarget) {
+		http.Error(w, "Reply target not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		log.Printf("IBM ML model failed: %v, falling back to basic analysis", err)
-		// Fallback to basic analysis if ML fails
-		score, flagged, fallbackErr := services.AnalyzeToxicity(input.Content)
-		if fallbackErr != nil {
-			http.Error(w, "Toxicity service failed", http.StatusInternalServerError)
-			return
-		}
-		
-		userID := r.Context().Value("user_id").(uint)
-		post := models.Post{
-			UserID:        userID,
-			Content:       input.Content,
-			ToxicityScore: int(score),
-			IsFlagged:     flagged,
-		}
-		config.DB.Create(&post)
-		
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(post)
+		http.Error(w, "Error loading reply target", http.StatusInternalServerError)
 		return
 	}
 
-	userID := r.Context().Value("user_id").(uint)
+	// ✅ Analyze toxicity in its conversation through the configured
+	// provider pipeline, and check the users the post is aimed at for a
+	// harassment pattern
+	screened, err := screenContent(userID, input.Content, postMessage(replyTo), harassment.Source{})
+	if err != nil {
+		writeScreeningError(w, err)
+		return
+	}
+	result := screened.result
 
-	// Create post with ML results
+	if rejectedByPolicy(w, input.Content, result) {
+		return
+	}
+
+	// Create post and keep the full analysis alongside it
 	post := models.Post{
-		UserID:        userID,
-		Content:       input.Content,
-		ToxicityScore: int(result.Score),
-		IsFlagged:     result.IsFlagged,
+		UserID:    userID,
+		Content:   input.Content,
+		ReplyToID: input.ReplyToID,
 	}
+	applyAnalysis(&post, result)
+	post.State = stateForAnalysis(result)
 
-	config.DB.Create(&post)
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&post).Error; err != nil {
+			return err
+		}
+		analysis, err := saveAnalysis(tx, post.ID, result)
+		if err != nil {
+			return err
+		}
+		if err := recordRevision(tx, &post, userID, analysis); err != nil {
+			return err
+		}
+		if err := harassment.Record(tx, postInteraction(&post), screened.targets, screened.assessment); err != nil {
+			return err
+		}
+		return queueForReview(tx, &post, notifies(result))
+	})
+	if err != nil {
+		http.Error(w, "Error saving post", http.StatusInternalServerError)
+		return
+	}
+	notifyPolicy(fmt.Sprintf("post %d", post.ID), result)
 
-	// Return enhanced response with ML analysis
+	// Return the post together with the full analysis
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	
+
 	response := map[string]interface{}{
-		"post": post,
-		"analysis": map[string]interface{}{
-			"score":       result.Score,
-			"severity":    result.Severity,
-			"sentiment":   result.Sentiment,
-			"categories":  result.Categories,
-			"suggestions": result.Suggestions,
-			"confidence":  result.Confidence,
-		},
+		"post":     post,
+		"analysis": result,
 	}
 	json.NewEncoder(w).Encode(response)
 }
 
+// CheckPost runs the analysis pipeline over a draft without saving it, so
+// the author can reconsider before publishing
+func CheckPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input CreatePostInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	if input.Content == "" {
+		http.Error(w, "Content is required", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(uint)
+	replyTo, err := replyTarget(input.ReplyToID, userID)
+	if errors.Is(err, errNoReplyTarget) {
+		http.Error(w, "Reply target not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error loading reply target", http.StatusInternalServerError)
+		return
+	}
+
+	screened, err := screenContent(userID, input.Content, postMessage(replyTo), harassment.Source{})
+	if err != nil {
+		writeScreeningError(w, err)
+		return
+	}
+	result := screened.result
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"analysis":    result,
+		"spans":       result.Detections,
+		"nudges":      services.Nudges(result),
+		"rephrasings": services.SuggestRephrasings(input.Content, result),
+		"would_flag":  result.IsFlagged,
+	})
+}
+
 func GetMyPosts(w http.ResponseWriter, r *http.Request) {
     userID := r.Context().Value("user_id").(uint)
 
     var posts []models.Post
-    result := config.DB.Where("user_id = ?", userID).Find(&posts)
+    result := withAnalyses(config.DB, r).Where("user_id = ?", userID).Find(&posts)
     if result.Error != nil {
         http.Error(w, "Error fetching posts", http.StatusInternalServerError)
         return
@@ -256,13 +334,83 @@ func EditPost(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    // 4. Update the content
-    post.Content = input.Content
-    config.DB.Save(&post)
+    if !editable(post.State) {
+        http.Error(w, "Post can no longer be edited", http.StatusForbidden)
+        return
+    }
 
-    // 5. Return updated post
+    if input.Content == "" {
+        http.Error(w, "Content is required", http.StatusBadRequest)
+        return
+    }
+
+    // 4. Score the new content in its conversation through the same
+    // pipeline as CreatePost; it may aim at other users than before
+    var replyTo *models.Post
+    if post.ReplyToID != nil {
+        var parent models.Post
+        if config.DB.Unscoped().Limit(1).Find(&parent, *post.ReplyToID).RowsAffected > 0 {
+            replyTo = &parent
+        }
+    }
+    screened, err := screenContent(userID, input.Content, postMessage(replyTo), harassment.Source{PostID: post.ID})
+    if err != nil {
+        writeScreeningError(w, err)
+        return
+    }
+    analysis := screened.result
+
+    if rejectedByPolicy(w, input.Content, analysis) {
+        return
+    }
+
+    // 5. Update the post and record the new content as a revision. Posts
+    // created before revisions existed get their original content saved first.
+    wasFlagged := post.IsFlagged
+
+    err = config.DB.Transaction(func(tx *gorm.DB) error {
+        if err := ensureInitialRevision(tx, &post); err != nil {
+            return err
+        }
+
+        post.Content = input.Content
+        post.State = stateAfterEdit(post.State, post.PolicyAction, analysis)
+        applyAnalysis(&post, analysis)
+        if err := tx.Save(&post).Error; err != nil {
+            return err
+        }
+
+        saved, err := saveAnalysis(tx, post.ID, analysis)
+        if err != nil {
+            return err
+        }
+        if err := recordRevision(tx, &post, userID, saved); err != nil {
+            return err
+        }
+        if err := harassment.Record(tx, postInteraction(&post), screened.targets, screened.assessment); err != nil {
+            return err
+        }
+        return queueForReview(tx, &post, notifies(analysis))
+    })
+    if err != nil {
+        http.Error(w, "Error saving post", http.StatusInternalServerError)
+        return
+    }
+    notifyPolicy(fmt.Sprintf("post %d", post.ID), analysis)
+
+    // A post that becomes flagged goes back to the moderation queue
+    requeued := post.IsFlagged && !wasFlagged
+    if requeued {
+        log.Printf("Post %d flagged after edit, re-queued for moderation", post.ID)
+    }
+
+    // 6. Return updated post with its new analysis
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(post)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "post":     post,
+        "analysis": analysis,
+        "requeued": requeued,
+    })
 }
 func DeletePost(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodDelete {
@@ -292,16 +440,48 @@ func DeletePost(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    // 4. Delete the post
-    config.DB.Delete(&post)
+    // 4. Soft-delete the post. It disappears for users but admins keep it
+    // until the retention period runs out.
+    err = config.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Model(&post).Update("deleted_by", userID).Error; err != nil {
+            return err
+        }
+        if err := tx.Delete(&post).Error; err != nil {
+            return err
+        }
+        _, err := moderation.Record(tx, &post, models.ModerationAction{ActorID: userID, Action: models.ActionDelete})
+        return err
+    })
+    if err != nil {
+        http.Error(w, "Error deleting post", http.StatusInternalServerError)
+        return
+    }
 
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(map[string]string{"message": "Post deleted successfully"})
 }
 func AdminDashboard(w http.ResponseWriter, r *http.Request) {
+	// Post counts per lifecycle state, so held posts are not missed
+	type stateCount struct {
+		State string
+		Count int64
+	}
+	var rows []stateCount
+	config.DB.Unscoped().Model(&models.Post{}).Select("state, COUNT(*) AS count").Group("state").Scan(&rows)
+
+	postsByState := map[string]int64{}
+	for _, row := range rows {
+		postsByState[row.State] = row.Count
+	}
+
+	var deleted int64
+	config.DB.Unscoped().Model(&models.Post{}).Where("deleted_at IS NOT NULL").Count(&deleted)
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Welcome to the admin dashboard!",
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":        "Welcome to the admin dashboard!",
+		"posts_by_state": postsByState,
+		"deleted_posts":  deleted,
 	})
 }
 func GetFlaggedPosts(w http.ResponseWriter, r *http.Request) {
@@ -311,9 +491,21 @@ func GetFlaggedPosts(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    // 2️⃣ Query the database for flagged posts
+    // 2️⃣ Query the database for flagged posts, optionally in one ?state=.
+    // Posts a moderator already rejected or removed are left out by default.
+    query := withAnalyses(config.DB, r).Where("is_flagged = ?", true)
+    if state := r.URL.Query().Get("state"); state != "" {
+        // Removed posts are soft-deleted
+        if state == models.PostRemoved {
+            query = query.Unscoped()
+        }
+        query = query.Where("state = ?", state)
+    } else {
+        query = query.Where("state NOT IN ?", []string{models.PostRejected, models.PostRemoved})
+    }
+
     var flaggedPosts []models.Post
-    result := config.DB.Where("is_flagged = ?", true).Find(&flaggedPosts)
+    result := query.Find(&flaggedPosts)
     if result.Error != nil {
         http.Error(w, "Error fetching flagged posts", http.StatusInternalServerError)
         return
@@ -330,7 +522,9 @@ func MarkPostSafe(w http.ResponseWriter, r *http.Request) {
     }
 
     type Input struct {
-        PostID uint `json:"post_id"`
+        PostID     uint   `json:"post_id"`
+        ReasonCode string `json:"reason_code"`
+        Note       string `json:"note"`
     }
 
     var input Input
@@ -340,17 +534,16 @@ func MarkPostSafe(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    var post models.Post
-    result := config.DB.First(&post, input.PostID)
-    if result.Error != nil {
-        http.Error(w, "Post not found", http.StatusNotFound)
+    // Marking a post safe publishes it and clears the flag
+    if _, ok := moderatePost(w, r, input.PostID, moderationDecision{
+        Action:     models.ActionMarkSafe,
+        State:      models.PostPublished,
+        ReasonCode: input.ReasonCode,
+        Note:       input.Note,
+    }); !ok {
         return
     }
 
-    // Mark the post as safe
-    post.IsFlagged = false
-    config.DB.Save(&post)
-
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(map[string]string{"message": "Post marked as safe"})
 }
@@ -362,7 +555,9 @@ func DeleteFlaggedPost(w http.ResponseWriter, r *http.Request) {
     }
 
     type Input struct {
-        PostID uint `json:"post_id"`
+        PostID     uint   `json:"post_id"`
+        ReasonCode string `json:"reason_code"`
+        Note       string `json:"note"`
     }
 
     var input Input
@@ -372,16 +567,16 @@ func DeleteFlaggedPost(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    var post models.Post
-    result := config.DB.First(&post, input.PostID)
-    if result.Error != nil {
-        http.Error(w, "Post not found", http.StatusNotFound)
+    // Removed posts are kept for the record but never shown
+    if _, ok := moderatePost(w, r, input.PostID, moderationDecision{
+        Action:     models.ActionRemove,
+        State:      models.PostRemoved,
+        ReasonCode: input.ReasonCode,
+        Note:       input.Note,
+    }); !ok {
         return
     }
 
-    // Delete the post
-    config.DB.Delete(&post)
-
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(map[string]string{"message": "Post deleted successfully"})
+    json.NewEncoder(w).Encode(map[string]string{"message": "Post removed successfully"})
 }
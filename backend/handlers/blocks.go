@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/elham-abdu/cyberbullyprevention/blocks"
+	"github.com/elham-abdu/cyberbullyprevention/config"
+	"github.com/elham-abdu/cyberbullyprevention/models"
+	"gorm.io/gorm"
+)
+
+// otherUser decodes {"user_id": ...} for the block and mute endpoints and
+// checks the user exists and is not the caller. It writes the error
+// response and reports false when the request cannot go on.
+func otherUser(w http.ResponseWriter, r *http.Request, method string) (uint, uint, bool) {
+	if r.Method != method {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return 0, 0, false
+	}
+
+	var input FollowInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	userID := r.Context().Value("user_id").(uint)
+	if input.UserID == userID {
+		http.Error(w, "You cannot do that to yourself", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	var user models.User
+	if err := config.DB.First(&user, input.UserID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return 0, 0, false
+	}
+	return userID, user.ID, true
+}
+
+// writeRelation answers a block or mute list
+func writeRelation(w http.ResponseWriter, entries []blocks.Entry, err error) {
+	if err != nil {
+		http.Error(w, "Error fetching users", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// GetBlocks lists the users the caller blocked, most recent first
+func GetBlocks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(uint)
+	entries, err := blocks.Blocked(config.DB, userID)
+	writeRelation(w, entries, err)
+}
+
+// BlockUser blocks a user: the two no longer see each other's content or
+// reach each other with replies and mentions, and their follows end
+func BlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, blockedID, ok := otherUser(w, r, http.MethodPost)
+	if !ok {
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return blocks.Block(tx, userID, blockedID)
+	})
+	if err != nil {
+		http.Error(w, "Error blocking user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"blocker_id": userID,
+		"blocked_id": blockedID,
+	})
+}
+
+// UnblockUser lifts a block the caller set
+func UnblockUser(w http.ResponseWriter, r *http.Request) {
+	userID, blockedID, ok := otherUser(w, r, http.MethodDelete)
+	if !ok {
+		return
+	}
+
+	if err := blocks.Unblock(config.DB, userID, blockedID); err != nil {
+		http.Error(w, "Error unblocking user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Unblocked"})
+}
+
+// GetMutes lists the users the caller muted, most recent first
+func GetMutes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(uint)
+	entries, err := blocks.Muted(config.DB, userID)
+	writeRelation(w, entries, err)
+}
+
+// MuteUser silently hides a user's content from the caller
+func MuteUser(w http.ResponseWriter, r *http.Request) {
+	userID, mutedID, ok := otherUser(w, r, http.MethodPost)
+	if !ok {
+		return
+	}
+
+	if err := blocks.Mute(config.DB, userID, mutedID); err != nil {
+		http.Error(w, "Error muting user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"muter_id": userID,
+		"muted_id": mutedID,
+	})
+}
+
+// UnmuteUser shows a muted user's content to the caller again
+func UnmuteUser(w http.ResponseWriter, r *http.Request) {
+	userID, mutedID, ok := otherUser(w, r, http.MethodDelete)
+	if !ok {
+		return
+	}
+
+	if err := blocks.Unmute(config.DB, userID, mutedID); err != nil {
+		http.Error(w, "Error unmuting user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Unmuted"})
+}
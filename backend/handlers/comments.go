@@ -0,0 +1,450 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/elham-abdu/cyberbullyprevention/blocks"
+	"github.com/elham-abdu/cyberbullyprevention/config"
+	"github.com/elham-abdu/cyberbullyprevention/harassment"
+	"github.com/elham-abdu/cyberbullyprevention/models"
+	"github.com/elham-abdu/cyberbullyprevention/moderation"
+	"github.com/elham-abdu/cyberbullyprevention/services"
+	"gorm.io/gorm"
+)
+
+// errNoParentComment is returned when a comment replies to a comment its
+// author cannot see, or one on another post
+var errNoParentComment = errors.New("parent comment not found")
+
+// CreateCommentInput is the body of CreateComment. ParentID answers
+// another comment on the same post instead of the post itself.
+type CreateCommentInput struct {
+	PostID   uint   `json:"post_id"`
+	ParentID *uint  `json:"parent_id"`
+	Content  string `json:"content"`
+}
+
+// parentComment loads the comment a new comment replies to. Like posts,
+// only published comments and the author's own can be answered, and never
+// across a block.
+func parentComment(parentID *uint, postID, userID uint) (*models.Comment, error) {
+	if parentID == nil {
+		return nil, nil
+	}
+	var parent models.Comment
+	if err := config.DB.First(&parent, *parentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errNoParentComment
+		}
+		return nil, err
+	}
+	if parent.PostID != postID || (parent.State != models.PostPublished && parent.UserID != userID) {
+		return nil, errNoParentComment
+	}
+	blocked, err := blocks.Between(config.DB, userID, parent.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, errNoParentComment
+	}
+	return &parent, nil
+}
+
+// applyCommentAnalysis copies the summary fields of a result onto a comment
+func applyCommentAnalysis(comment *models.Comment, result *services.ToxicityResult) {
+	comment.ToxicityScore = int(result.Score)
+	comment.IsFlagged = result.IsFlagged
+	comment.Severity = result.Severity
+	comment.Sentiment = result.Sentiment
+	if result.Policy != nil {
+		comment.PolicyAction = string(result.Policy.Action)
+	}
+}
+
+// queueCommentForReview puts a comment in the moderation queue like
+// queueForReview does for posts
+func queueCommentForReview(tx *gorm.DB, comment *models.Comment, notify bool) error {
+	if comment.IsFlagged || notify || comment.State == models.PostPendingReview {
+		_, err := moderation.EnqueueComment(tx, comment, notify)
+		return err
+	}
+	return moderation.ResolveComment(tx, comment.ID, 0, "edited")
+}
+
+// CreateComment answers a post, or a comment on it, after screening the
+// content within its conversation like CreatePost
+func CreateComment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input CreateCommentInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if input.Content == "" {
+		http.Error(w, "Content is required", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(uint)
+	post, err := replyTarget(&input.PostID, userID)
+	if errors.Is(err, errNoReplyTarget) {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error loading post", http.StatusInternalServerError)
+		return
+	}
+	parent, err := parentComment(input.ParentID, post.ID, userID)
+	if errors.Is(err, errNoParentComment) {
+		http.Error(w, "Parent comment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error loading parent comment", http.StatusInternalServerError)
+		return
+	}
+
+	// The comment answers its parent comment, or the post at the top level
+	answered := postMessage(post)
+	if parent != nil {
+		answered = commentMessage(parent)
+	}
+	screened, err := screenContent(userID, input.Content, answered, harassment.Source{})
+	if err != nil {
+		writeScreeningError(w, err)
+		return
+	}
+	result := screened.result
+
+	if rejectedByPolicy(w, input.Content, result) {
+		return
+	}
+
+	comment := models.Comment{
+		PostID:   post.ID,
+		ParentID: input.ParentID,
+		UserID:   userID,
+		Content:  input.Content,
+	}
+	applyCommentAnalysis(&comment, result)
+	comment.State = stateForAnalysis(result)
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&comment).Error; err != nil {
+			return err
+		}
+		if err := saveCommentAnalysis(tx, &comment, result); err != nil {
+			return err
+		}
+		if err := harassment.Record(tx, commentInteraction(&comment), screened.targets, screened.assessment); err != nil {
+			return err
+		}
+		return queueCommentForReview(tx, &comment, notifies(result))
+	})
+	if err != nil {
+		http.Error(w, "Error saving comment", http.StatusInternalServerError)
+		return
+	}
+	notifyPolicy(fmt.Sprintf("comment %d", comment.ID), result)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"comment":  comment,
+		"analysis": result,
+	})
+}
+
+// GetComments lists the comments on ?post_id=, oldest first: the published
+// ones and the caller's own in any state, leaving out users on either side
+// of a block and users the caller muted. Replies carry their ParentID, so
+// clients can build the thread.
+func GetComments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	postID, err := strconv.ParseUint(r.URL.Query().Get("post_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "post_id is required", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(uint)
+	id := uint(postID)
+	if _, err := replyTarget(&id, userID); err != nil {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+
+	var comments []models.Comment
+	err = config.DB.Where("post_id = ?", id).
+		Where("state = ? OR user_id = ?", models.PostPublished, userID).
+		Where("user_id NOT IN (?)", blocks.Hidden(config.DB, userID)).
+		Order("created_at, id").
+		Find(&comments).Error
+	if err != nil {
+		http.Error(w, "Error fetching comments", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comments)
+}
+
+// EditComment changes the content of the caller's comment. The new content
+// is screened again and the comment's state and queue item follow it like
+// EditPost.
+func EditComment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		CommentID uint   `json:"comment_id"`
+		Content   string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(uint)
+	var comment models.Comment
+	if err := config.DB.First(&comment, input.CommentID).Error; err != nil || comment.UserID != userID {
+		http.Error(w, "Comment not found or unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !editable(comment.State) {
+		http.Error(w, "Comment can no longer be edited", http.StatusForbidden)
+		return
+	}
+	if input.Content == "" {
+		http.Error(w, "Content is required", http.StatusBadRequest)
+		return
+	}
+
+	// What the comment answers may have been deleted since
+	var answered *harassment.Message
+	if comment.ParentID != nil {
+		var parent models.Comment
+		if config.DB.Unscoped().Limit(1).Find(&parent, *comment.ParentID).RowsAffected > 0 {
+			answered = commentMessage(&parent)
+		}
+	} else {
+		var post models.Post
+		if config.DB.Unscoped().Limit(1).Find(&post, comment.PostID).RowsAffected > 0 {
+			answered = postMessage(&post)
+		}
+	}
+	screened, err := screenContent(userID, input.Content, answered, harassment.Source{CommentID: comment.ID})
+	if err != nil {
+		writeScreeningError(w, err)
+		return
+	}
+	result := screened.result
+
+	if rejectedByPolicy(w, input.Content, result) {
+		return
+	}
+
+	wasFlagged := comment.IsFlagged
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		comment.Content = input.Content
+		comment.State = stateAfterEdit(comment.State, comment.PolicyAction, result)
+		applyCommentAnalysis(&comment, result)
+		if err := tx.Save(&comment).Error; err != nil {
+			return err
+		}
+		if err := saveCommentAnalysis(tx, &comment, result); err != nil {
+			return err
+		}
+		if err := harassment.Record(tx, commentInteraction(&comment), screened.targets, screened.assessment); err != nil {
+			return err
+		}
+		return queueCommentForReview(tx, &comment, notifies(result))
+	})
+	if err != nil {
+		http.Error(w, "Error saving comment", http.StatusInternalServerError)
+		return
+	}
+	notifyPolicy(fmt.Sprintf("comment %d", comment.ID), result)
+
+	requeued := comment.IsFlagged && !wasFlagged
+	if requeued {
+		log.Printf("Comment %d flagged after edit, re-queued for moderation", comment.ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"comment":  comment,
+		"analysis": result,
+		"requeued": requeued,
+	})
+}
+
+// DeleteComment soft-deletes the caller's comment. Like posts, it
+// disappears for users but admins keep it until the retention period runs
+// out.
+func DeleteComment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		CommentID uint `json:"comment_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(uint)
+	var comment models.Comment
+	if err := config.DB.First(&comment, input.CommentID).Error; err != nil || comment.UserID != userID {
+		http.Error(w, "Comment not found or unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&comment).Update("deleted_by", userID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&comment).Error; err != nil {
+			return err
+		}
+		_, err := moderation.RecordComment(tx, &comment, models.ModerationAction{ActorID: userID, Action: models.ActionDelete})
+		return err
+	})
+	if err != nil {
+		http.Error(w, "Error deleting comment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Comment deleted successfully"})
+}
+
+// transitionComment moves a comment to a new state on behalf of a moderator
+// with the same rules as transitionPost
+func transitionComment(tx *gorm.DB, comment *models.Comment, decision moderationDecision, actorID uint) error {
+	to := decision.State
+	if comment.State != to && !models.CanTransition(comment.State, to) {
+		return fmt.Errorf("%w: cannot move comment from %s to %s", errBadTransition, comment.State, to)
+	}
+	if err := checkReason(tx, decision); err != nil {
+		return err
+	}
+	if err := moderation.CheckCommentClaim(tx, comment.ID, actorID); err != nil {
+		return err
+	}
+
+	from := comment.State
+	comment.State = to
+	switch to {
+	case models.PostPublished:
+		comment.IsFlagged = false
+	case models.PostPendingReview:
+		comment.IsFlagged = true
+	}
+	if to == models.PostRemoved && !comment.DeletedAt.Valid {
+		comment.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+		comment.DeletedBy = &actorID
+	} else if from == models.PostRemoved && to != models.PostRemoved {
+		comment.DeletedAt = gorm.DeletedAt{}
+		comment.DeletedBy = nil
+	}
+	// Unscoped, so removed comments can be saved too
+	if err := tx.Unscoped().Save(comment).Error; err != nil {
+		return err
+	}
+
+	if to == models.PostPendingReview {
+		if _, err := moderation.EnqueueComment(tx, comment, false); err != nil {
+			return err
+		}
+	} else if err := moderation.ResolveComment(tx, comment.ID, actorID, to); err != nil {
+		return err
+	}
+
+	action, err := moderation.RecordComment(tx, comment, models.ModerationAction{
+		ActorID:     actorID,
+		Action:      decision.Action,
+		ReasonCode:  decision.ReasonCode,
+		Note:        decision.Note,
+		BeforeState: from,
+		AfterState:  to,
+	})
+	if err != nil {
+		return err
+	}
+	subject := models.Strike{UserID: comment.UserID, CommentID: &comment.ID}
+	if err := countStrike(tx, subject, action, actorID); err != nil {
+		return err
+	}
+
+	log.Printf("Comment %d moved from %s to %s by user %d", comment.ID, from, to, actorID)
+	return nil
+}
+
+// TransitionComment moves a comment to another lifecycle state
+func TransitionComment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		CommentID  uint   `json:"comment_id"`
+		State      string `json:"state"`
+		ReasonCode string `json:"reason_code"`
+		Note       string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if !models.IsPostState(input.State) {
+		http.Error(w, "Unknown state", http.StatusBadRequest)
+		return
+	}
+
+	var comment models.Comment
+	if err := config.DB.Unscoped().First(&comment, input.CommentID).Error; err != nil {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
+
+	from := comment.State
+	actorID := r.Context().Value("user_id").(uint)
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return transitionComment(tx, &comment, moderationDecision{
+			Action:     stateActions[input.State],
+			State:      input.State,
+			ReasonCode: input.ReasonCode,
+			Note:       input.Note,
+		}, actorID)
+	})
+	if err != nil {
+		writeTransitionError(w, err, "Comment", from, input.State)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comment)
+}
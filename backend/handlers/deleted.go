@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/elham-abdu/cyberbullyprevention/config"
+	"github.com/elham-abdu/cyberbullyprevention/models"
+	"github.com/elham-abdu/cyberbullyprevention/moderation"
+	"gorm.io/gorm"
+)
+
+// GetDeletedPosts lists soft-deleted posts, most recently deleted first,
+// optionally for one ?user_id=. ?include=analysis adds the analyses.
+func GetDeletedPosts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := withAnalyses(config.DB.Unscoped(), r).Where("deleted_at IS NOT NULL")
+	if value := r.URL.Query().Get("user_id"); value != "" {
+		userID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid user_id", http.StatusBadRequest)
+			return
+		}
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var posts []models.Post
+	if err := query.Order("deleted_at DESC").Find(&posts).Error; err != nil {
+		http.Error(w, "Error fetching deleted posts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(posts)
+}
+
+// RestorePost brings back a soft-deleted post. A post a moderator removed
+// is published again; a post its author deleted keeps the state it had.
+func RestorePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		PostID     uint   `json:"post_id"`
+		ReasonCode string `json:"reason_code"`
+		Note       string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	var post models.Post
+	if err := config.DB.Unscoped().First(&post, input.PostID).Error; err != nil {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if !post.DeletedAt.Valid {
+		http.Error(w, "Post is not deleted", http.StatusConflict)
+		return
+	}
+
+	if post.State == models.PostRemoved {
+		restored, ok := moderatePost(w, r, post.ID, moderationDecision{
+			Action:     models.ActionRestore,
+			State:      models.PostPublished,
+			ReasonCode: input.ReasonCode,
+			Note:       input.Note,
+		})
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(restored)
+		return
+	}
+
+	actorID := r.Context().Value("user_id").(uint)
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkReason(tx, moderationDecision{ReasonCode: input.ReasonCode}); err != nil {
+			return err
+		}
+		err := tx.Unscoped().Model(&post).Updates(map[string]interface{}{"deleted_at": nil, "deleted_by": nil}).Error
+		if err != nil {
+			return err
+		}
+		post.DeletedAt = gorm.DeletedAt{}
+		post.DeletedBy = nil
+		_, err = moderation.Record(tx, &post, models.ModerationAction{
+			ActorID:    actorID,
+			Action:     models.ActionRestore,
+			ReasonCode: input.ReasonCode,
+			Note:       input.Note,
+		})
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errUnknownReason) {
+			http.Error(w, "A valid reason_code is required: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Error restoring post", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(post)
+}
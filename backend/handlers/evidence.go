@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elham-abdu/cyberbullyprevention/config"
+	"github.com/elham-abdu/cyberbullyprevention/evidence"
+	"github.com/elham-abdu/cyberbullyprevention/models"
+	"github.com/elham-abdu/cyberbullyprevention/moderation"
+	"gorm.io/gorm"
+)
+
+// ExportCase builds an evidence bundle for ?user_id= or ?post_ids=1,2,3.
+// The default ?format=zip returns the ZIP bundle and its manifest digest in
+// the X-Manifest-SHA256 header; ?format=html returns only the report. Each
+// export puts its posts and comments under legal hold and is recorded in the
+// audit log.
+func ExportCase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	var scope evidence.Scope
+	if value := query.Get("user_id"); value != "" {
+		userID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || userID == 0 {
+			http.Error(w, "Invalid user_id", http.StatusBadRequest)
+			return
+		}
+		scope.UserID = uint(userID)
+	} else if value := query.Get("post_ids"); value != "" {
+		for _, part := range strings.Split(value, ",") {
+			postID, err := strconv.ParseUint(strings.TrimSpace(part), 10, 64)
+			if err != nil || postID == 0 {
+				http.Error(w, "Invalid post_ids", http.StatusBadRequest)
+				return
+			}
+			scope.PostIDs = append(scope.PostIDs, uint(postID))
+		}
+	} else {
+		http.Error(w, "user_id or post_ids is required", http.StatusBadRequest)
+		return
+	}
+
+	format := query.Get("format")
+	if format == "" {
+		format = "zip"
+	}
+	if format != "zip" && format != "html" {
+		http.Error(w, "Format must be zip or html", http.StatusBadRequest)
+		return
+	}
+
+	actorID := r.Context().Value("user_id").(uint)
+	c, err := evidence.Collect(config.DB, scope, actorID, time.Now())
+	if err != nil {
+		http.Error(w, "Error collecting evidence", http.StatusInternalServerError)
+		return
+	}
+	if len(c.Posts) == 0 && scope.UserID == 0 {
+		http.Error(w, "No posts found", http.StatusNotFound)
+		return
+	}
+
+	var body bytes.Buffer
+	var digest string
+	if format == "html" {
+		err = evidence.Report(&body, c)
+	} else {
+		digest, err = evidence.Export(&body, c)
+	}
+	if err != nil {
+		http.Error(w, "Error building evidence bundle", http.StatusInternalServerError)
+		return
+	}
+
+	note := fmt.Sprintf("exported %s as %s", c.ID, format)
+	if digest != "" {
+		note += ", manifest sha256 " + digest
+	}
+	action := models.ModerationAction{ActorID: actorID, Action: models.ActionExport, Note: note}
+	if scope.UserID != 0 {
+		action.TargetUserID = &scope.UserID
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := evidence.Hold(tx, c); err != nil {
+			return err
+		}
+		_, err := moderation.Record(tx, nil, action)
+		return err
+	})
+	if err != nil {
+		http.Error(w, "Error recording export", http.StatusInternalServerError)
+		return
+	}
+
+	if format == "html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", c.ID+".zip"))
+		w.Header().Set("X-Manifest-SHA256", digest)
+	}
+	w.Write(body.Bytes())
+}
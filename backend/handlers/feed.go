@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/elham-abdu/cyberbullyprevention/blocks"
+	"github.com/elham-abdu/cyberbullyprevention/config"
+	"github.com/elham-abdu/cyberbullyprevention/feed"
+	"github.com/elham-abdu/cyberbullyprevention/models"
+)
+
+// feedOptions reads ?limit=, ?cursor= and ?show_flagged= for the calling
+// user
+func feedOptions(r *http.Request) feed.Options {
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	showFlagged, _ := strconv.ParseBool(query.Get("show_flagged"))
+	return feed.Options{
+		ViewerID:    r.Context().Value("user_id").(uint),
+		Limit:       limit,
+		Cursor:      query.Get("cursor"),
+		ShowFlagged: showFlagged,
+	}
+}
+
+// writeFeed answers with a feed page, or the error that kept it from
+// loading
+func writeFeed(w http.ResponseWriter, page *feed.Page, err error) {
+	if errors.Is(err, feed.ErrBadCursor) {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching feed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// GetFeed returns the global feed, newest first
+func GetFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	page, err := feed.Global(config.DB, feedOptions(r))
+	writeFeed(w, page, err)
+}
+
+// GetFollowingFeed returns the posts of the users the caller follows,
+// newest first
+func GetFollowingFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	page, err := feed.Following(config.DB, feedOptions(r))
+	writeFeed(w, page, err)
+}
+
+// GetUserFeed returns the profile timeline of ?user_id= or ?username=.
+// Users on either side of a block do not find each other.
+func GetUserFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	opts := feedOptions(r)
+	query := r.URL.Query()
+	var user models.User
+	var err error
+	if username := query.Get("username"); username != "" {
+		username = strings.ToLower(strings.TrimPrefix(username, "@"))
+		err = config.DB.Where("username = ?", username).First(&user).Error
+	} else if userID, parseErr := strconv.ParseUint(query.Get("user_id"), 10, 64); parseErr == nil {
+		err = config.DB.First(&user, userID).Error
+	} else {
+		http.Error(w, "user_id or username is required", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	blocked, err := blocks.Between(config.DB, opts.ViewerID, user.ID)
+	if err != nil {
+		http.Error(w, "Error fetching feed", http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	page, err := feed.Profile(config.DB, opts, user.ID)
+	if err != nil {
+		writeFeed(w, nil, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":     user.ID,
+		"username":    user.Username,
+		"entries":     page.Entries,
+		"next_cursor": page.NextCursor,
+	})
+}
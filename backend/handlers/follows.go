@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/elham-abdu/cyberbullyprevention/blocks"
+	"github.com/elham-abdu/cyberbullyprevention/config"
+	"github.com/elham-abdu/cyberbullyprevention/models"
+	"gorm.io/gorm/clause"
+)
+
+// FollowInput is the body of the follow endpoints
+type FollowInput struct {
+	UserID uint `json:"user_id"`
+}
+
+// GetFollows lists the users the caller follows, most recent first
+func GetFollows(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(uint)
+	var follows []models.Follow
+	if err := config.DB.Where("follower_id = ?", userID).Order("created_at DESC").Find(&follows).Error; err != nil {
+		http.Error(w, "Error fetching follows", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(follows)
+}
+
+// Follow adds a user's posts to the caller's following feed. Following
+// someone twice changes nothing.
+func Follow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input FollowInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(uint)
+	if input.UserID == userID {
+		http.Error(w, "You cannot follow yourself", http.StatusBadRequest)
+		return
+	}
+	var user models.User
+	if err := config.DB.First(&user, input.UserID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	blocked, err := blocks.Between(config.DB, userID, user.ID)
+	if err != nil {
+		http.Error(w, "Error saving follow", http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	follow := models.Follow{FollowerID: userID, FolloweeID: user.ID}
+	if err := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&follow).Error; err != nil {
+		http.Error(w, "Error saving follow", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"follower_id": userID,
+		"followee_id": user.ID,
+	})
+}
+
+// Unfollow takes a user's posts out of the caller's following feed
+func Unfollow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input FollowInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(uint)
+	err := config.DB.Where("follower_id = ? AND followee_id = ?", userID, input.UserID).Delete(&models.Follow{}).Error
+	if err != nil {
+		http.Error(w, "Error removing follow", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Unfollowed"})
+}
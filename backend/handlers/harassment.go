@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/elham-abdu/cyberbullyprevention/blocks"
+	"github.com/elham-abdu/cyberbullyprevention/config"
+	"github.com/elham-abdu/cyberbullyprevention/harassment"
+	"github.com/elham-abdu/cyberbullyprevention/models"
+	"github.com/elham-abdu/cyberbullyprevention/services"
+	"gorm.io/gorm"
+)
+
+// errNoReplyTarget is returned when a post replies to a post its author
+// cannot see
+var errNoReplyTarget = errors.New("reply target not found")
+
+// replyTarget loads the post a new post replies to. Only published posts
+// and the author's own posts can be answered, and never across a block.
+func replyTarget(replyToID *uint, userID uint) (*models.Post, error) {
+	if replyToID == nil {
+		return nil, nil
+	}
+	var parent models.Post
+	if err := config.DB.First(&parent, *replyToID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errNoReplyTarget
+		}
+		return nil, err
+	}
+	if parent.State != models.PostPublished && parent.UserID != userID {
+		return nil, errNoReplyTarget
+	}
+	blocked, err := blocks.Between(config.DB, userID, parent.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, errNoReplyTarget
+	}
+	return &parent, nil
+}
+
+var (
+	// errAnalysisFailed is returned when the toxicity pipeline could not
+	// score content
+	errAnalysisFailed = errors.New("toxicity analysis failed")
+	// errBlockedTarget is returned for content aimed at a user on the other
+	// side of a block
+	errBlockedTarget = errors.New("content is aimed at a blocked user")
+)
+
+// historyLimit caps the earlier posts given to the analyzers as context
+const historyLimit = 20
+
+// screening is content analyzed within its conversation, together with
+// the users it is aimed at and their harassment pattern check
+type screening struct {
+	result     *services.ToxicityResult
+	targets    []harassment.Target
+	assessment harassment.Assessment
+}
+
+// screenContent analyzes content by authorID within its conversation: the
+// post or comment it replies to, parent, and the recent posts and comments
+// between the author and the users it is aimed at. Those users are then
+// checked for a targeted harassment pattern, whose signals are fed to the
+// moderation policy, so it may flag content that would pass on its own.
+// source is the post or comment being edited, the zero Source for new
+// content.
+func screenContent(authorID uint, content string, parent *harassment.Message, source harassment.Source) (*screening, error) {
+	settings := harassment.SettingsFromEnv()
+	now := time.Now()
+	var replyToID uint
+	if parent != nil {
+		replyToID = parent.AuthorID
+	}
+	targets, err := harassment.Targets(config.DB, authorID, content, replyToID)
+	if err != nil {
+		return nil, err
+	}
+	for _, target := range targets {
+		blocked, err := blocks.Between(config.DB, authorID, target.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if blocked {
+			return nil, errBlockedTarget
+		}
+	}
+
+	thread := services.AnalysisContext{AuthorID: authorID}
+	exclude := []harassment.Source{source}
+	if parent != nil {
+		thread.Parent = contextMessage(*parent)
+		exclude = append(exclude, parent.Source)
+	}
+	history, err := harassment.Conversation(config.DB, settings, authorID, targets, exclude, now, historyLimit)
+	if err != nil {
+		return nil, err
+	}
+	for _, message := range history {
+		thread.History = append(thread.History, *contextMessage(message))
+	}
+
+	result, err := services.AnalyzeInContext(content, thread)
+	if err != nil {
+		log.Printf("Toxicity analysis failed: %v", err)
+		return nil, fmt.Errorf("%w: %v", errAnalysisFailed, err)
+	}
+
+	negative := settings.Negative(int(result.Score), result.Sentiment)
+	assessment, err := harassment.Assess(config.DB, settings, authorID, targets, negative, source, now)
+	if err != nil {
+		return nil, err
+	}
+	if assessment.Detected() {
+		services.ApplyPolicy(result, assessment.Values())
+	}
+	return &screening{result: result, targets: targets, assessment: assessment}, nil
+}
+
+// contextMessage turns a message of a conversation into a message of an
+// analysis context
+func contextMessage(message harassment.Message) *services.ContextMessage {
+	return &services.ContextMessage{
+		AuthorID:  message.AuthorID,
+		Content:   message.Content,
+		Score:     float64(message.ToxicityScore),
+		CreatedAt: message.CreatedAt,
+	}
+}
+
+// postMessage is a post as a message of its conversation, nil for no post
+func postMessage(post *models.Post) *harassment.Message {
+	if post == nil {
+		return nil
+	}
+	return &harassment.Message{
+		Source:        harassment.Source{PostID: post.ID},
+		AuthorID:      post.UserID,
+		Content:       post.Content,
+		ToxicityScore: post.ToxicityScore,
+		CreatedAt:     post.CreatedAt,
+	}
+}
+
+// postInteraction is what the interactions of a post have in common
+func postInteraction(post *models.Post) models.Interaction {
+	return models.Interaction{
+		ActorID:       post.UserID,
+		PostID:        post.ID,
+		ToxicityScore: post.ToxicityScore,
+		CreatedAt:     post.CreatedAt,
+	}
+}
+
+// commentInteraction is what the interactions of a comment have in common
+func commentInteraction(comment *models.Comment) models.Interaction {
+	return models.Interaction{
+		ActorID:       comment.UserID,
+		CommentID:     &comment.ID,
+		ToxicityScore: comment.ToxicityScore,
+		CreatedAt:     comment.CreatedAt,
+	}
+}
+
+// commentMessage is a comment as a message of its conversation
+func commentMessage(comment *models.Comment) *harassment.Message {
+	return &harassment.Message{
+		Source:        harassment.Source{CommentID: comment.ID},
+		AuthorID:      comment.UserID,
+		Content:       comment.Content,
+		ToxicityScore: comment.ToxicityScore,
+		CreatedAt:     comment.CreatedAt,
+	}
+}
+
+// writeScreeningError answers a failed screenContent
+func writeScreeningError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errBlockedTarget) {
+		http.Error(w, "You cannot reply to or mention a user you blocked or who blocked you", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, errAnalysisFailed) {
+		http.Error(w, "Toxicity service failed", http.StatusInternalServerError)
+		return
+	}
+	http.Error(w, "Error checking the conversation", http.StatusInternalServerError)
+}
+
+// GetHarassmentPatterns lists the users currently singled out by one author
+// or a group of authors, with ?target_id= limiting it to one user
+func GetHarassmentPatterns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var targetID uint64
+	if value := r.URL.Query().Get("target_id"); value != "" {
+		var err error
+		if targetID, err = strconv.ParseUint(value, 10, 64); err != nil {
+			http.Error(w, "Invalid target_id", http.StatusBadRequest)
+			return
+		}
+	}
+
+	settings := harassment.SettingsFromEnv()
+	patterns, err := harassment.Patterns(config.DB, settings, uint(targetID), time.Now())
+	if err != nil {
+		http.Error(w, "Error fetching harassment patterns", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"window_minutes": settings.Window.Minutes(),
+		"patterns":       patterns,
+	})
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/elham-abdu/cyberbullyprevention/config"
+	"github.com/elham-abdu/cyberbullyprevention/lexicon"
+	"github.com/elham-abdu/cyberbullyprevention/models"
+	"github.com/elham-abdu/cyberbullyprevention/services"
+	"gorm.io/gorm"
+)
+
+// GetLexicon returns the active lexicon version and its files
+func GetLexicon(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lexicon.Active())
+}
+
+// ReloadLexicon reloads the lexicon files without restarting the server
+func ReloadLexicon(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	lex, err := lexicon.Reload()
+	if err != nil {
+		log.Printf("Lexicon reload failed: %v", err)
+		http.Error(w, "Lexicon reload failed: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lex)
+}
+
+// SyncCustomLexicon loads the moderator-managed terms from the database
+// into the active lexicon
+func SyncCustomLexicon() error {
+	var terms []models.LexiconTerm
+	if err := config.DB.Order("id ASC").Find(&terms).Error; err != nil {
+		return err
+	}
+
+	var latest models.LexiconTermAudit
+	config.DB.Order("id DESC").Limit(1).Find(&latest)
+
+	entries := []lexicon.Entry{}
+	allow := []string{}
+	for _, term := range terms {
+		if term.Kind == models.LexiconTermAllow {
+			allow = append(allow, term.Term)
+			continue
+		}
+		entries = append(entries, lexicon.Entry{
+			Term:     term.Term,
+			Category: term.Category,
+			Weight:   term.Weight,
+			Severity: term.Severity,
+			Source:   fmt.Sprintf("custom:%d", term.ID),
+		})
+	}
+
+	version := ""
+	if latest.ID > 0 {
+		version = strconv.FormatUint(uint64(latest.ID), 10)
+	}
+	return lexicon.SetCustomTerms(version, entries, allow)
+}
+
+// LexiconTermInput is the body of the custom term endpoints
+type LexiconTermInput struct {
+	ID       uint    `json:"id"`
+	Term     string  `json:"term"`
+	Kind     string  `json:"kind"`
+	Category string  `json:"category"`
+	Weight   float64 `json:"weight"`
+	Severity string  `json:"severity"`
+	Note     string  `json:"note"`
+}
+
+// validate normalizes the input and returns a message when it is invalid
+func (input *LexiconTermInput) validate() string {
+	input.Term = strings.TrimSpace(input.Term)
+	input.Kind = strings.ToLower(strings.TrimSpace(input.Kind))
+	input.Severity = strings.ToLower(strings.TrimSpace(input.Severity))
+
+	if input.Term == "" || strings.TrimSuffix(input.Term, "*") == "" {
+		return "Term is required"
+	}
+	if input.Kind != models.LexiconTermBlock && input.Kind != models.LexiconTermAllow {
+		return "Kind must be \"block\" or \"allow\""
+	}
+	if input.Kind == models.LexiconTermBlock {
+		if strings.TrimSpace(input.Category) == "" {
+			return "Category is required for blocked terms"
+		}
+		input.Category = services.CanonicalCategory(input.Category)
+	} else {
+		input.Category = ""
+	}
+	switch input.Severity {
+	case "", "low", "medium", "high", "critical":
+	default:
+		return "Severity must be low, medium, high or critical"
+	}
+	if input.Weight < 0 {
+		return "Weight cannot be negative"
+	}
+	if input.Weight == 0 {
+		input.Weight = 1
+	}
+	return ""
+}
+
+// GetLexiconTerms lists the custom terms, optionally filtered by ?kind=
+func GetLexiconTerms(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := config.DB.Order("term ASC")
+	if kind := r.URL.Query().Get("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+
+	var terms []models.LexiconTerm
+	if err := query.Find(&terms).Error; err != nil {
+		http.Error(w, "Error fetching terms", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(terms)
+}
+
+// CreateLexiconTerm adds a custom blocked or allowed term
+func CreateLexiconTerm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input LexiconTermInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if msg := input.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	var existing models.LexiconTerm
+	if config.DB.Where("LOWER(term) = LOWER(?) AND kind = ?", input.Term, input.Kind).Limit(1).Find(&existing).RowsAffected > 0 {
+		http.Error(w, "Term already exists", http.StatusConflict)
+		return
+	}
+
+	actorID := r.Context().Value("user_id").(uint)
+	term := models.LexiconTerm{
+		Term:      input.Term,
+		Kind:      input.Kind,
+		Category:  input.Category,
+		Weight:    input.Weight,
+		Severity:  input.Severity,
+		Note:      input.Note,
+		CreatedBy: actorID,
+		UpdatedBy: actorID,
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&term).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.LexiconTermAudit{TermID: term.ID, ActorID: actorID, Action: "create", After: &term}).Error
+	})
+	if err != nil {
+		http.Error(w, "Error saving term", http.StatusInternalServerError)
+		return
+	}
+
+	if !syncLexiconOrFail(w) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(term)
+}
+
+// UpdateLexiconTerm changes a custom term
+func UpdateLexiconTerm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input LexiconTermInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if msg := input.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	var term models.LexiconTerm
+	if err := config.DB.First(&term, input.ID).Error; err != nil {
+		http.Error(w, "Term not found", http.StatusNotFound)
+		return
+	}
+
+	actorID := r.Context().Value("user_id").(uint)
+	before := term
+	term.Term = input.Term
+	term.Kind = input.Kind
+	term.Category = input.Category
+	term.Weight = input.Weight
+	term.Severity = input.Severity
+	term.Note = input.Note
+	term.UpdatedBy = actorID
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&term).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.LexiconTermAudit{TermID: term.ID, ActorID: actorID, Action: "update", Before: &before, After: &term}).Error
+	})
+	if err != nil {
+		http.Error(w, "Error saving term", http.StatusInternalServerError)
+		return
+	}
+
+	if !syncLexiconOrFail(w) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(term)
+}
+
+// DeleteLexiconTerm removes a custom term
+func DeleteLexiconTerm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		ID uint `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	var term models.LexiconTerm
+	if err := config.DB.First(&term, input.ID).Error; err != nil {
+		http.Error(w, "Term not found", http.StatusNotFound)
+		return
+	}
+
+	actorID := r.Context().Value("user_id").(uint)
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&term).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.LexiconTermAudit{TermID: term.ID, ActorID: actorID, Action: "delete", Before: &term}).Error
+	})
+	if err != nil {
+		http.Error(w, "Error deleting term", http.StatusInternalServerError)
+		return
+	}
+
+	if !syncLexiconOrFail(w) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Term deleted successfully"})
+}
+
+// GetLexiconTermAudit returns the change history of custom terms,
+// optionally for a single ?term_id=
+func GetLexiconTermAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := config.DB.Order("created_at DESC")
+	if termID := r.URL.Query().Get("term_id"); termID != "" {
+		query = query.Where("term_id = ?", termID)
+	}
+
+	var audit []models.LexiconTermAudit
+	if err := query.Find(&audit).Error; err != nil {
+		http.Error(w, "Error fetching audit log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(audit)
+}
+
+// syncLexiconOrFail applies the saved terms to the analyzers, writing an
+// error response when that fails
+func syncLexiconOrFail(w http.ResponseWriter) bool {
+	if err := SyncCustomLexicon(); err != nil {
+		log.Printf("Failed to apply custom lexicon terms: %v", err)
+		http.Error(w, "Term saved but could not be applied: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+
+	"github.com/elham-abdu/cyberbullyprevention/config"
+	"github.com/elham-abdu/cyberbullyprevention/models"
+	"github.com/elham-abdu/cyberbullyprevention/policy"
+	"gorm.io/gorm"
+)
+
+// defaultPolicyNote marks policy versions saved from the built-in rules
+const defaultPolicyNote = "Built-in default policy"
+
+// SyncPolicy activates the newest saved moderation policy, saving the
+// built-in rules as version 1 when there is none yet. Until an admin saves
+// a policy, updated built-in rules are saved as a new version.
+func SyncPolicy() error {
+	var latest models.PolicyVersion
+	if err := config.DB.Order("version DESC").Limit(1).Find(&latest).Error; err != nil {
+		return err
+	}
+
+	if latest.ID == 0 {
+		latest = models.PolicyVersion{Version: 1, Rules: policy.DefaultRules(), Note: defaultPolicyNote}
+		if err := config.DB.Create(&latest).Error; err != nil {
+			return err
+		}
+	} else if latest.CreatedBy == 0 && !reflect.DeepEqual(latest.Rules, policy.DefaultRules()) {
+		// Nobody has edited the policy yet, follow changes to the built-in rules
+		latest = models.PolicyVersion{Version: latest.Version + 1, Rules: policy.DefaultRules(), Note: defaultPolicyNote}
+		if err := config.DB.Create(&latest).Error; err != nil {
+			return err
+		}
+	}
+
+	p, err := policy.Compile(latest.Version, latest.Rules)
+	if err != nil {
+		return err
+	}
+	policy.SetActive(p)
+	log.Printf("Moderation policy version %d active (%d rules)", p.Version, len(p.Rules))
+	return nil
+}
+
+// GetPolicy returns the active moderation policy
+func GetPolicy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy.Active())
+}
+
+// GetPolicyVersions lists every saved policy version, newest first
+func GetPolicyVersions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var versions []models.PolicyVersion
+	if err := config.DB.Order("version DESC").Find(&versions).Error; err != nil {
+		http.Error(w, "Error fetching policy versions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// UpdatePolicy saves a new policy version and activates it
+func UpdatePolicy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		Rules []policy.Rule `json:"rules"`
+		Note  string        `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	// Reject rules that do not compile before anything is saved
+	if _, err := policy.Compile(0, input.Rules); err != nil {
+		http.Error(w, "Invalid policy: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	actorID := r.Context().Value("user_id").(uint)
+	version, err := savePolicyVersion(input.Rules, input.Note, actorID)
+	if err != nil {
+		http.Error(w, "Error saving policy", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(version)
+}
+
+// ActivatePolicyVersion restores an earlier policy by saving its rules as a
+// new version, so the history stays linear
+func ActivatePolicyVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		Version int `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	var previous models.PolicyVersion
+	if err := config.DB.Where("version = ?", input.Version).First(&previous).Error; err != nil {
+		http.Error(w, "Policy version not found", http.StatusNotFound)
+		return
+	}
+
+	actorID := r.Context().Value("user_id").(uint)
+	note := fmt.Sprintf("Restored from version %d", previous.Version)
+	version, err := savePolicyVersion(previous.Rules, note, actorID)
+	if err != nil {
+		http.Error(w, "Error saving policy", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(version)
+}
+
+// savePolicyVersion stores rules as the next version and activates them
+func savePolicyVersion(rules []policy.Rule, note string, actorID uint) (*models.PolicyVersion, error) {
+	var version models.PolicyVersion
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var latest models.PolicyVersion
+		if err := tx.Order("version DESC").Limit(1).Find(&latest).Error; err != nil {
+			return err
+		}
+		version = models.PolicyVersion{
+			Version:   latest.Version + 1,
+			Rules:     rules,
+			Note:      note,
+			CreatedBy: actorID,
+		}
+		return tx.Create(&version).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := policy.Compile(version.Version, version.Rules)
+	if err != nil {
+		return nil, err
+	}
+	policy.SetActive(p)
+	log.Printf("Moderation policy version %d activated by user %d", version.Version, actorID)
+	return &version, nil
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/elham-abdu/cyberbullyprevention/config"
+	"github.com/elham-abdu/cyberbullyprevention/models"
+	"github.com/elham-abdu/cyberbullyprevention/moderation"
+	"gorm.io/gorm"
+)
+
+// QueueItemInput is the body of the queue item endpoints
+type QueueItemInput struct {
+	ItemID      uint `json:"item_id"`
+	ModeratorID uint `json:"moderator_id"`
+}
+
+// GetModerationQueue lists the open queue items in priority order, with
+// their posts. ?limit= defaults to 50.
+func GetModerationQueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	items, err := moderation.List(config.DB, limit)
+	if err != nil {
+		http.Error(w, "Error fetching moderation queue", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// NextQueueItem claims the next item for the calling moderator. It answers
+// 204 when there is nothing left to review.
+func NextQueueItem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	moderatorID := r.Context().Value("user_id").(uint)
+	item, err := moderation.Next(config.DB, moderatorID, moderation.LeaseDuration())
+	if err != nil {
+		http.Error(w, "Error claiming next item", http.StatusInternalServerError)
+		return
+	}
+	if item == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeQueueItem(w, item)
+}
+
+// ClaimQueueItem claims a specific item, or renews the caller's lease on it
+func ClaimQueueItem(w http.ResponseWriter, r *http.Request) {
+	queueAction(w, r, func(input QueueItemInput, moderatorID uint) (*models.ModerationQueueItem, error) {
+		return moderation.Claim(config.DB, input.ItemID, moderatorID, moderation.LeaseDuration())
+	})
+}
+
+// ReleaseQueueItem gives up the caller's claim on an item
+func ReleaseQueueItem(w http.ResponseWriter, r *http.Request) {
+	queueAction(w, r, func(input QueueItemInput, moderatorID uint) (*models.ModerationQueueItem, error) {
+		return moderation.Release(config.DB, input.ItemID, moderatorID)
+	})
+}
+
+// SkipQueueItem passes on an item; it is not handed to the caller again
+func SkipQueueItem(w http.ResponseWriter, r *http.Request) {
+	queueAction(w, r, func(input QueueItemInput, moderatorID uint) (*models.ModerationQueueItem, error) {
+		return moderation.Skip(config.DB, input.ItemID, moderatorID)
+	})
+}
+
+// ReassignQueueItem hands an item to another moderator
+func ReassignQueueItem(w http.ResponseWriter, r *http.Request) {
+	queueAction(w, r, func(input QueueItemInput, moderatorID uint) (*models.ModerationQueueItem, error) {
+		return moderation.Reassign(config.DB, input.ItemID, moderatorID, input.ModeratorID, moderation.LeaseDuration())
+	})
+}
+
+// queueAction decodes a queue item request, runs action for the calling
+// moderator and maps queue errors onto status codes
+func queueAction(w http.ResponseWriter, r *http.Request, action func(QueueItemInput, uint) (*models.ModerationQueueItem, error)) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input QueueItemInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	moderatorID := r.Context().Value("user_id").(uint)
+	item, err := action(input, moderatorID)
+	switch {
+	case err == nil:
+		writeQueueItem(w, item)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "Queue item not found", http.StatusNotFound)
+	case errors.Is(err, moderation.ErrNotModerator):
+		http.Error(w, "Moderator not found", http.StatusBadRequest)
+	case errors.Is(err, moderation.ErrClaimed), errors.Is(err, moderation.ErrNotClaimed), errors.Is(err, moderation.ErrResolved):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Error updating queue item", http.StatusInternalServerError)
+	}
+}
+
+// writeQueueItem responds with an item, its post and, for comment items,
+// its comment
+func writeQueueItem(w http.ResponseWriter, item *models.ModerationQueueItem) {
+	if item.CommentID != nil && item.Comment == nil {
+		var comment models.Comment
+		if err := config.DB.Unscoped().First(&comment, *item.CommentID).Error; err == nil {
+			item.Comment = &comment
+		}
+	}
+	if item.Post == nil {
+		var post models.Post
+		if err := config.DB.Unscoped().First(&post, item.PostID).Error; err == nil {
+			item.Post = &post
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elham-abdu/cyberbullyprevention/config"
+	"github.com/elham-abdu/cyberbullyprevention/models"
+	"gorm.io/gorm"
+)
+
+// defaultReasons is the taxonomy every installation starts with
+var defaultReasons = []models.ViolationReason{
+	{Code: "threat", Label: "Threat", Description: "Threatens violence or harm against someone", StrikeWeight: 3},
+	{Code: "targeted_harassment", Label: "Targeted harassment", Description: "Insults, demeans or repeatedly goes after a specific person", StrikeWeight: 2},
+	{Code: "identity_hate", Label: "Identity hate", Description: "Attacks people for who they are, such as their race, religion, gender or sexuality", StrikeWeight: 2},
+	{Code: "doxxing", Label: "Doxxing", Description: "Shares someone's private or identifying information without consent", StrikeWeight: 3},
+	{Code: "sexual_content", Label: "Sexual content", Description: "Sexually explicit content or unwanted sexual remarks", StrikeWeight: 2},
+	{Code: "spam", Label: "Spam", Description: "Repetitive, misleading or promotional content", StrikeWeight: 1},
+}
+
+// enforcementStates are the states that take content away from its
+// audience; moving a post into one requires a violation reason
+var enforcementStates = map[string]bool{
+	models.PostHidden:   true,
+	models.PostRejected: true,
+	models.PostRemoved:  true,
+}
+
+var (
+	// errReasonRequired is returned for enforcement actions without a reason
+	errReasonRequired = errors.New("a violation reason is required")
+	// errUnknownReason is returned for codes outside the active taxonomy
+	errUnknownReason = errors.New("unknown violation reason")
+)
+
+// reasonCodePattern is the shape of a reason code
+var reasonCodePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// SyncViolationReasons adds the default reasons that are missing, and the
+// default strike weight of built-in reasons saved without one. Reasons an
+// admin changed or retired are left alone otherwise.
+func SyncViolationReasons() error {
+	for _, defaults := range defaultReasons {
+		reason := defaults
+		reason.Active = true
+		err := config.DB.Where(models.ViolationReason{Code: reason.Code}).FirstOrCreate(&reason).Error
+		if err != nil {
+			return err
+		}
+		if reason.StrikeWeight == 0 {
+			if err := config.DB.Model(&reason).Update("strike_weight", defaults.StrikeWeight).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// strikeWeight returns the strikes a violation of reasonCode adds
+func strikeWeight(tx *gorm.DB, reasonCode string) (float64, error) {
+	var reason models.ViolationReason
+	if err := tx.Where("code = ?", reasonCode).Limit(1).Find(&reason).Error; err != nil {
+		return 0, err
+	}
+	if reason.StrikeWeight <= 0 {
+		return 1, nil
+	}
+	return reason.StrikeWeight, nil
+}
+
+// checkReason validates the reason of a moderator decision against the
+// active taxonomy
+func checkReason(tx *gorm.DB, decision moderationDecision) error {
+	if decision.ReasonCode == "" {
+		if enforcementStates[decision.State] {
+			return errReasonRequired
+		}
+		return nil
+	}
+
+	var count int64
+	err := tx.Model(&models.ViolationReason{}).Where("code = ? AND active = ?", decision.ReasonCode, true).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errUnknownReason
+	}
+	return nil
+}
+
+// ViolationReasonInput is the body of the violation reason endpoints
+type ViolationReasonInput struct {
+	ID           uint     `json:"id"`
+	Code         string   `json:"code"`
+	Label        string   `json:"label"`
+	Description  string   `json:"description"`
+	StrikeWeight *float64 `json:"strike_weight"`
+	Active       *bool    `json:"active"`
+}
+
+// GetViolationReasons lists the taxonomy. Retired reasons are included
+// with ?include=inactive.
+func GetViolationReasons(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := config.DB.Order("label ASC")
+	if r.URL.Query().Get("include") != "inactive" {
+		query = query.Where("active = ?", true)
+	}
+
+	var reasons []models.ViolationReason
+	if err := query.Find(&reasons).Error; err != nil {
+		http.Error(w, "Error fetching reasons", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reasons)
+}
+
+// CreateViolationReason adds a reason to the taxonomy
+func CreateViolationReason(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input ViolationReasonInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	input.Code = strings.TrimSpace(input.Code)
+	input.Label = strings.TrimSpace(input.Label)
+	if !reasonCodePattern.MatchString(input.Code) {
+		http.Error(w, "Code must be lowercase letters, digits and underscores", http.StatusBadRequest)
+		return
+	}
+	if input.Label == "" {
+		http.Error(w, "Label is required", http.StatusBadRequest)
+		return
+	}
+
+	var existing models.ViolationReason
+	if config.DB.Where("code = ?", input.Code).Limit(1).Find(&existing).RowsAffected > 0 {
+		http.Error(w, "Reason already exists", http.StatusConflict)
+		return
+	}
+
+	reason := models.ViolationReason{
+		Code:         input.Code,
+		Label:        input.Label,
+		Description:  input.Description,
+		StrikeWeight: 1,
+		Active:       input.Active == nil || *input.Active,
+	}
+	if input.StrikeWeight != nil {
+		if *input.StrikeWeight <= 0 {
+			http.Error(w, "Strike weight must be positive", http.StatusBadRequest)
+			return
+		}
+		reason.StrikeWeight = *input.StrikeWeight
+	}
+	if err := config.DB.Create(&reason).Error; err != nil {
+		http.Error(w, "Error saving reason", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(reason)
+}
+
+// UpdateViolationReason changes the label, description, strike weight or
+// active flag of a reason. The code stays as it is.
+func UpdateViolationReason(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input ViolationReasonInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	var reason models.ViolationReason
+	if err := config.DB.First(&reason, input.ID).Error; err != nil {
+		http.Error(w, "Reason not found", http.StatusNotFound)
+		return
+	}
+	if input.Code != "" && input.Code != reason.Code {
+		http.Error(w, "Reason codes cannot be changed", http.StatusBadRequest)
+		return
+	}
+
+	if label := strings.TrimSpace(input.Label); label != "" {
+		reason.Label = label
+	}
+	if input.Description != "" {
+		reason.Description = input.Description
+	}
+	if input.StrikeWeight != nil {
+		if *input.StrikeWeight <= 0 {
+			http.Error(w, "Strike weight must be positive", http.StatusBadRequest)
+			return
+		}
+		reason.StrikeWeight = *input.StrikeWeight
+	}
+	if input.Active != nil {
+		reason.Active = *input.Active
+	}
+	if err := config.DB.Save(&reason).Error; err != nil {
+		http.Error(w, "Error saving reason", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reason)
+}
+
+// ModerationNotice tells an author what a moderator did to one of their
+// posts or comments and why. Internal notes and the moderator's identity
+// are left out.
+type ModerationNotice struct {
+	ID        uint                    `json:"id"`
+	PostID    *uint                   `json:"post_id"`
+	CommentID *uint                   `json:"comment_id,omitempty"`
+	Action    string                  `json:"action"`
+	State     string                  `json:"state"`
+	Reason    *models.ViolationReason `json:"reason,omitempty"`
+	CreatedAt time.Time               `json:"created_at"`
+}
+
+// authorActions are the actions authors are told about
+var authorActions = []string{
+	models.ActionApprove,
+	models.ActionMarkSafe,
+	models.ActionHold,
+	models.ActionHide,
+	models.ActionReject,
+	models.ActionRemove,
+	models.ActionRestore,
+	models.ActionAppealUpheld,
+	models.ActionAppealOverturned,
+}
+
+// GetMyModeration lists the moderation decisions on the caller's posts and
+// comments, newest first, with the reason given for each
+func GetMyModeration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(uint)
+	var actions []models.ModerationAction
+	err := config.DB.Where("target_user_id = ? AND action IN ?", userID, authorActions).
+		Order("created_at DESC, id DESC").
+		Find(&actions).Error
+	if err != nil {
+		http.Error(w, "Error fetching moderation history", http.StatusInternalServerError)
+		return
+	}
+
+	reasons, err := reasonsByCode()
+	if err != nil {
+		http.Error(w, "Error fetching moderation history", http.StatusInternalServerError)
+		return
+	}
+
+	notices := make([]ModerationNotice, 0, len(actions))
+	for _, action := range actions {
+		notice := ModerationNotice{
+			ID:        action.ID,
+			PostID:    action.PostID,
+			CommentID: action.CommentID,
+			Action:    action.Action,
+			State:     action.AfterState,
+			CreatedAt: action.CreatedAt,
+		}
+		if reason, ok := reasons[action.ReasonCode]; ok {
+			notice.Reason = &reason
+		}
+		notices = append(notices, notice)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notices)
+}
+
+// ReasonStats counts the actions taken for one violation reason
+type ReasonStats struct {
+	Code     string           `json:"code"`
+	Label    string           `json:"label"`
+	Total    int64            `json:"total"`
+	ByAction map[string]int64 `json:"by_action"`
+}
+
+// GetReasonAnalytics counts enforcement actions per violation reason and
+// action, most used first. ?from= and ?to= limit the date range like the
+// audit log.
+func GetReasonAnalytics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, err := parseAuditTime(r.URL.Query().Get("from"), false)
+	if err != nil {
+		http.Error(w, "Invalid from date", http.StatusBadRequest)
+		return
+	}
+	to, err := parseAuditTime(r.URL.Query().Get("to"), true)
+	if err != nil {
+		http.Error(w, "Invalid to date", http.StatusBadRequest)
+		return
+	}
+
+	query := config.DB.Model(&models.ModerationAction{}).
+		Select("reason_code, action, COUNT(*) AS count").
+		Where("reason_code <> ''")
+	if !from.IsZero() {
+		query = query.Where("created_at >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("created_at < ?", to)
+	}
+
+	var rows []struct {
+		ReasonCode string
+		Action     string
+		Count      int64
+	}
+	if err := query.Group("reason_code, action").Scan(&rows).Error; err != nil {
+		http.Error(w, "Error computing reason analytics", http.StatusInternalServerError)
+		return
+	}
+
+	reasons, err := reasonsByCode()
+	if err != nil {
+		http.Error(w, "Error computing reason analytics", http.StatusInternalServerError)
+		return
+	}
+
+	byCode := map[string]*ReasonStats{}
+	for _, row := range rows {
+		stats, ok := byCode[row.ReasonCode]
+		if !ok {
+			stats = &ReasonStats{Code: row.ReasonCode, Label: reasons[row.ReasonCode].Label, ByAction: map[string]int64{}}
+			byCode[row.ReasonCode] = stats
+		}
+		stats.Total += row.Count
+		stats.ByAction[row.Action] += row.Count
+	}
+
+	report := make([]ReasonStats, 0, len(byCode))
+	for _, stats := range byCode {
+		report = append(report, *stats)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Total != report[j].Total {
+			return report[i].Total > report[j].Total
+		}
+		return report[i].Code < report[j].Code
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// reasonsByCode loads the whole taxonomy, retired reasons included
+func reasonsByCode() (map[string]models.ViolationReason, error) {
+	var reasons []models.ViolationReason
+	if err := config.DB.Find(&reasons).Error; err != nil {
+		return nil, err
+	}
+	byCode := make(map[string]models.ViolationReason, len(reasons))
+	for _, reason := range reasons {
+		byCode[reason.Code] = reason
+	}
+	return byCode, nil
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/elham-abdu/cyberbullyprevention/config"
+	"github.com/elham-abdu/cyberbullyprevention/models"
+	"github.com/elham-abdu/cyberbullyprevention/utils"
+	"gorm.io/gorm"
+)
+
+// recordRevision stores the current content of a post as a new revision
+func recordRevision(tx *gorm.DB, post *models.Post, editorID uint, analysis *models.PostAnalysis) error {
+	revision := models.PostRevision{
+		PostID:   post.ID,
+		EditorID: editorID,
+		Content:  post.Content,
+	}
+	if analysis != nil {
+		revision.AnalysisID = &analysis.ID
+	}
+	return tx.Create(&revision).Error
+}
+
+// ensureInitialRevision saves the current content of a post that has no
+// revisions yet, so its original wording is never lost on edit
+func ensureInitialRevision(tx *gorm.DB, post *models.Post) error {
+	var count int64
+	if err := tx.Model(&models.PostRevision{}).Where("post_id = ?", post.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	var analysis models.PostAnalysis
+	result := tx.Where("post_id = ? AND comment_id IS NULL", post.ID).Order("created_at DESC").Limit(1).Find(&analysis)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return recordRevision(tx, post, post.UserID, nil)
+	}
+	return recordRevision(tx, post, post.UserID, &analysis)
+}
+
+// GetPostRevisions returns every revision of a post, oldest first
+func GetPostRevisions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	postID, err := strconv.ParseUint(r.URL.Query().Get("post_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "post_id is required", http.StatusBadRequest)
+		return
+	}
+
+	var post models.Post
+	if err := config.DB.Unscoped().First(&post, postID).Error; err != nil {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+
+	var revisions []models.PostRevision
+	result := config.DB.Preload("Analysis").Where("post_id = ?", post.ID).Order("created_at ASC, id ASC").Find(&revisions)
+	if result.Error != nil {
+		http.Error(w, "Error fetching revisions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"post":      post,
+		"revisions": revisions,
+	})
+}
+
+// DiffPostRevisions returns a word-level diff between two revisions of a
+// post. When "to" is omitted the latest revision is used.
+func DiffPostRevisions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	postID, err := strconv.ParseUint(query.Get("post_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "post_id is required", http.StatusBadRequest)
+		return
+	}
+	fromID, err := strconv.ParseUint(query.Get("from"), 10, 64)
+	if err != nil {
+		http.Error(w, "from revision is required", http.StatusBadRequest)
+		return
+	}
+
+	var from models.PostRevision
+	if err := config.DB.Where("post_id = ?", postID).First(&from, fromID).Error; err != nil {
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+
+	var to models.PostRevision
+	if query.Get("to") == "" {
+		err = config.DB.Where("post_id = ?", postID).Order("created_at DESC, id DESC").First(&to).Error
+	} else {
+		toID, parseErr := strconv.ParseUint(query.Get("to"), 10, 64)
+		if parseErr != nil {
+			http.Error(w, "Invalid to revision", http.StatusBadRequest)
+			return
+		}
+		err = config.DB.Where("post_id = ?", postID).First(&to, toID).Error
+	}
+	if err != nil {
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from": from,
+		"to":   to,
+		"diff": utils.DiffWords(from.Content, to.Content),
+	})
+}
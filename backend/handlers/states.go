@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elham-abdu/cyberbullyprevention/config"
+	"github.com/elham-abdu/cyberbullyprevention/models"
+	"github.com/elham-abdu/cyberbullyprevention/moderation"
+	"github.com/elham-abdu/cyberbullyprevention/policy"
+	"github.com/elham-abdu/cyberbullyprevention/services"
+	"github.com/elham-abdu/cyberbullyprevention/strikes"
+	"gorm.io/gorm"
+)
+
+// stateForAnalysis returns the state new content starts in, as decided by
+// the moderation policy
+func stateForAnalysis(result *services.ToxicityResult) string {
+	if result.Policy == nil {
+		return models.PostPublished
+	}
+	switch result.Policy.Action {
+	case policy.ActionHold:
+		return models.PostPendingReview
+	case policy.ActionShadowHide:
+		return models.PostHidden
+	}
+	return models.PostPublished
+}
+
+// stateAfterEdit returns the state of a post or comment after its author
+// changed it, given its current state and policy action. Content hidden by a
+// moderator stays hidden and held content stays held until a moderator
+// decides; everything else follows the new analysis. Rejected and removed
+// content cannot be edited.
+func stateAfterEdit(state, policyAction string, result *services.ToxicityResult) string {
+	if state == models.PostHidden && policyAction != string(policy.ActionShadowHide) {
+		return models.PostHidden
+	}
+	if state == models.PostPendingReview {
+		return models.PostPendingReview
+	}
+	return stateForAnalysis(result)
+}
+
+// editable reports whether the author may still change a post or comment
+// in this state
+func editable(state string) bool {
+	return state != models.PostRejected && state != models.PostRemoved
+}
+
+// queueForReview puts a flagged or held post, or one a notifying policy
+// rule fired on, in the moderation queue, or takes it out when its author
+// edited it into something the policy allows
+func queueForReview(tx *gorm.DB, post *models.Post, notify bool) error {
+	if post.IsFlagged || notify || post.State == models.PostPendingReview {
+		_, err := moderation.Enqueue(tx, post, notify)
+		return err
+	}
+	return moderation.Resolve(tx, post.ID, 0, "edited")
+}
+
+// errBadTransition is returned for state changes the lifecycle does not allow
+var errBadTransition = errors.New("state change not allowed")
+
+// moderationDecision is a moderator's change to a post, as it is recorded in
+// the audit log
+type moderationDecision struct {
+	Action     string
+	State      string
+	ReasonCode string
+	Note       string
+}
+
+// stateActions names the action that moves a post into each state
+var stateActions = map[string]string{
+	models.PostPublished:     models.ActionApprove,
+	models.PostPendingReview: models.ActionHold,
+	models.PostHidden:        models.ActionHide,
+	models.PostRejected:      models.ActionReject,
+	models.PostRemoved:       models.ActionRemove,
+}
+
+// transitionPost moves a post to a new state on behalf of a moderator and
+// records the decision in the audit log. Taking a post down requires a
+// reason from the violation taxonomy. Removing a post also soft-deletes it,
+// and moving it out of removed restores it. Publishing a post clears its flag,
+// holding it for review sets it and queues it again. Any other decision
+// resolves its queue item, which fails with moderation.ErrClaimed while
+// another moderator holds the item.
+func transitionPost(tx *gorm.DB, post *models.Post, decision moderationDecision, actorID uint) error {
+	to := decision.State
+	if post.State != to && !models.CanTransition(post.State, to) {
+		return fmt.Errorf("%w: cannot move post from %s to %s", errBadTransition, post.State, to)
+	}
+	if err := checkReason(tx, decision); err != nil {
+		return err
+	}
+	if err := moderation.CheckClaim(tx, post.ID, actorID); err != nil {
+		return err
+	}
+
+	from := post.State
+	post.State = to
+	switch to {
+	case models.PostPublished:
+		post.IsFlagged = false
+	case models.PostPendingReview:
+		post.IsFlagged = true
+	}
+	if to == models.PostRemoved && !post.DeletedAt.Valid {
+		post.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+		post.DeletedBy = &actorID
+	} else if from == models.PostRemoved && to != models.PostRemoved {
+		post.DeletedAt = gorm.DeletedAt{}
+		post.DeletedBy = nil
+	}
+	// Unscoped, so removed posts can be saved too
+	if err := tx.Unscoped().Save(post).Error; err != nil {
+		return err
+	}
+
+	if to == models.PostPendingReview {
+		if _, err := moderation.Enqueue(tx, post, false); err != nil {
+			return err
+		}
+	} else if err := moderation.Resolve(tx, post.ID, actorID, to); err != nil {
+		return err
+	}
+
+	action, err := moderation.Record(tx, post, models.ModerationAction{
+		ActorID:     actorID,
+		Action:      decision.Action,
+		ReasonCode:  decision.ReasonCode,
+		Note:        decision.Note,
+		BeforeState: from,
+		AfterState:  to,
+	})
+	if err != nil {
+		return err
+	}
+	subject := models.Strike{UserID: post.UserID, PostID: &post.ID}
+	if err := countStrike(tx, subject, action, actorID); err != nil {
+		return err
+	}
+
+	log.Printf("Post %d moved from %s to %s by user %d", post.ID, from, to, actorID)
+	return nil
+}
+
+// countStrike keeps the author's strikes in line with a moderator decision.
+// Taking a post or comment down is a confirmed violation and adds a strike;
+// publishing it again withdraws the strike. subject names the author and the
+// post or comment.
+func countStrike(tx *gorm.DB, subject models.Strike, action *models.ModerationAction, actorID uint) error {
+	settings := strikes.SettingsFromEnv()
+	switch {
+	case enforcementStates[action.AfterState]:
+		weight, err := strikeWeight(tx, action.ReasonCode)
+		if err != nil {
+			return err
+		}
+		strike := subject
+		strike.ActionID = &action.ID
+		strike.ReasonCode = action.ReasonCode
+		strike.Weight = weight
+		strike.IssuedBy = actorID
+		sanction, err := strikes.Issue(tx, settings, strike, time.Now())
+		if err != nil {
+			return err
+		}
+		if sanction != nil {
+			log.Printf("User %d sanctioned with %s at %.2f strike points", sanction.UserID, sanction.Kind, sanction.Points)
+		}
+	case action.AfterState == models.PostPublished && subject.CommentID != nil:
+		return strikes.RevokeComment(tx, settings, *subject.CommentID, actorID, time.Now())
+	case action.AfterState == models.PostPublished:
+		return strikes.Revoke(tx, settings, *subject.PostID, actorID, time.Now())
+	}
+	return nil
+}
+
+// TransitionPost moves a post to another lifecycle state
+func TransitionPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		PostID     uint   `json:"post_id"`
+		State      string `json:"state"`
+		ReasonCode string `json:"reason_code"`
+		Note       string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if !models.IsPostState(input.State) {
+		http.Error(w, "Unknown state", http.StatusBadRequest)
+		return
+	}
+
+	post, ok := moderatePost(w, r, input.PostID, moderationDecision{
+		Action:     stateActions[input.State],
+		State:      input.State,
+		ReasonCode: input.ReasonCode,
+		Note:       input.Note,
+	})
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(post)
+}
+
+// moderatePost loads a post, deleted or not, and applies a moderator
+// decision to it, writing the error response when that fails
+func moderatePost(w http.ResponseWriter, r *http.Request, postID uint, decision moderationDecision) (*models.Post, bool) {
+	var post models.Post
+	if err := config.DB.Unscoped().First(&post, postID).Error; err != nil {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	actorID := r.Context().Value("user_id").(uint)
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return transitionPost(tx, &post, decision, actorID)
+	})
+	if err != nil {
+		writeTransitionError(w, err, "Post", post.State, decision.State)
+		return nil, false
+	}
+	return &post, true
+}
+
+// writeTransitionError answers a failed transitionPost or transitionComment
+// with the matching status code. subject is "Post" or "Comment".
+func writeTransitionError(w http.ResponseWriter, err error, subject, from, to string) {
+	noun := strings.ToLower(subject)
+	switch {
+	case errors.Is(err, errBadTransition):
+		http.Error(w, fmt.Sprintf("Cannot move %s from %s to %s", noun, from, to), http.StatusConflict)
+	case errors.Is(err, errReasonRequired), errors.Is(err, errUnknownReason):
+		http.Error(w, "A valid reason_code is required: "+err.Error(), http.StatusBadRequest)
+	case errors.Is(err, moderation.ErrClaimed):
+		http.Error(w, subject+" is claimed by another moderator", http.StatusConflict)
+	default:
+		http.Error(w, "Error updating "+noun, http.StatusInternalServerError)
+	}
+}
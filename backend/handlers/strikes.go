@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/elham-abdu/cyberbullyprevention/config"
+	"github.com/elham-abdu/cyberbullyprevention/models"
+	"github.com/elham-abdu/cyberbullyprevention/strikes"
+	"gorm.io/gorm"
+)
+
+// GetUserStrikes returns the strike history of ?user_id=: the current
+// decayed standing, the thresholds it is measured against, every strike and
+// every sanction, newest first
+func GetUserStrikes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := strconv.ParseUint(r.URL.Query().Get("user_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	settings := strikes.SettingsFromEnv()
+	now := time.Now()
+	points, err := strikes.Standing(config.DB, settings, user.ID, now)
+	if err != nil {
+		http.Error(w, "Error fetching strikes", http.StatusInternalServerError)
+		return
+	}
+	history, sanctions, err := strikes.History(config.DB, user.ID)
+	if err != nil {
+		http.Error(w, "Error fetching strikes", http.StatusInternalServerError)
+		return
+	}
+
+	active := []models.Sanction{}
+	for _, sanction := range sanctions {
+		if sanction.ActiveAt(now) {
+			active = append(active, sanction)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":          user.ID,
+		"points":           points,
+		"half_life_days":   settings.HalfLife.Hours() / 24,
+		"thresholds":       settings.Thresholds,
+		"active_sanctions": active,
+		"strikes":          history,
+		"sanctions":        sanctions,
+	})
+}
+
+// LiftSanction ends a sanction early
+func LiftSanction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		SanctionID uint   `json:"sanction_id"`
+		Note       string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	actorID := r.Context().Value("user_id").(uint)
+	var sanction *models.Sanction
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		sanction, err = strikes.Lift(tx, input.SanctionID, actorID, time.Now(), input.Note)
+		return err
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Sanction not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error lifting sanction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sanction)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/elham-abdu/cyberbullyprevention/config"
+	"github.com/elham-abdu/cyberbullyprevention/models"
+)
+
+// usernamePattern is what can follow an @ in a mention
+var usernamePattern = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+var (
+	errBadUsername   = errors.New("username must be 3 to 30 letters, digits or underscores")
+	errUsernameTaken = errors.New("username is already taken")
+)
+
+// checkUsername normalizes a username to lower case and makes sure nobody
+// but userID has it. userID is 0 for new accounts.
+func checkUsername(username string, userID uint) (string, error) {
+	username = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(username), "@"))
+	if !usernamePattern.MatchString(username) {
+		return "", errBadUsername
+	}
+	var taken int64
+	err := config.DB.Model(&models.User{}).Where("username = ? AND id <> ?", username, userID).Count(&taken).Error
+	if err != nil {
+		return "", err
+	}
+	if taken > 0 {
+		return "", errUsernameTaken
+	}
+	return username, nil
+}
+
+// writeUsernameError answers a rejected username
+func writeUsernameError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errBadUsername):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errUsernameTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Error checking username", http.StatusInternalServerError)
+	}
+}
+
+// SetUsername picks or changes the username others @mention the user by
+func SetUsername(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(uint)
+	username, err := checkUsername(input.Username, userID)
+	if err != nil {
+		writeUsernameError(w, err)
+		return
+	}
+	if err := config.DB.Model(&models.User{}).Where("id = ?", userID).Update("username", username).Error; err != nil {
+		http.Error(w, "Error saving username", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":  userID,
+		"username": username,
+	})
+}
@@ -0,0 +1,445 @@
+// Package harassment finds users singled out across many posts and
+// comments.
+//
+// Content is scored one piece at a time, but twenty harmless looking posts
+// at the same classmate within an hour are bullying. Every post or comment
+// that mentions or replies to another user is recorded as an interaction,
+// and each new one is checked against the interactions of a sliding
+// window: repeated negative or borderline content from one author toward
+// the same target, a flood of content of any kind toward them, or negative
+// content from a group of authors piling onto one target. Patterns become
+// policy signals, so they feed the flagging decision, and raise the queue
+// priority of the content that is part of them.
+package harassment
+
+import (
+    "regexp"
+    "slices"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/elham-abdu/cyberbullyprevention/config"
+    "github.com/elham-abdu/cyberbullyprevention/models"
+    "gorm.io/gorm"
+)
+
+// Settings configure pattern detection
+type Settings struct {
+    // Window is how far back interactions count
+    Window time.Duration
+    // Repeats is how many negative interactions from one author toward one
+    // target make a pattern
+    Repeats int
+    // Flood is how many interactions of any kind from one author toward
+    // one target make a pattern
+    Flood int
+    // GroupSize is how many distinct authors with negative interactions
+    // toward one target make a coordinated pattern
+    GroupSize int
+    // BorderlineScore is the toxicity score from which content counts as
+    // negative whatever its sentiment
+    BorderlineScore int
+}
+
+// SettingsFromEnv reads the settings from HARASSMENT_WINDOW_MINUTES
+// (default 60), HARASSMENT_REPEATS (default 3), HARASSMENT_FLOOD (default
+// 10), HARASSMENT_GROUP_SIZE (default 3) and HARASSMENT_BORDERLINE_SCORE
+// (default 20)
+func SettingsFromEnv() Settings {
+    return Settings{
+        Window:          time.Duration(envInt("HARASSMENT_WINDOW_MINUTES", 60)) * time.Minute,
+        Repeats:         envInt("HARASSMENT_REPEATS", 3),
+        Flood:           envInt("HARASSMENT_FLOOD", 10),
+        GroupSize:       envInt("HARASSMENT_GROUP_SIZE", 3),
+        BorderlineScore: envInt("HARASSMENT_BORDERLINE_SCORE", 20),
+    }
+}
+
+// envInt reads a positive whole number from the environment
+func envInt(key string, fallback int) int {
+    value, err := strconv.Atoi(config.GetEnvOrDefault(key, ""))
+    if err != nil || value <= 0 {
+        return fallback
+    }
+    return value
+}
+
+// Negative reports whether content with this score and sentiment counts
+// toward a pattern
+func (s Settings) Negative(score int, sentiment string) bool {
+    negative := sentiment == "negative" || sentiment == "very_negative"
+    return negative || score >= s.BorderlineScore
+}
+
+// Target is a user a post or comment is aimed at
+type Target struct {
+    UserID uint
+    Kind   string
+}
+
+// Source is the post or comment interactions come from. CommentID is set
+// for comments and PostID for posts; the zero Source is content that is
+// not saved yet.
+type Source struct {
+    PostID    uint
+    CommentID uint
+}
+
+// exclude leaves the interactions of the source out of query, e.g. those of
+// content being edited
+func (s Source) exclude(query *gorm.DB) *gorm.DB {
+    switch {
+    case s.CommentID != 0:
+        return query.Where("comment_id IS NULL OR comment_id <> ?", s.CommentID)
+    case s.PostID != 0:
+        return query.Where("post_id <> ?", s.PostID)
+    }
+    return query
+}
+
+// mentionPattern matches @username, but not the middle of an e-mail address
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@(\w{3,30})\b`)
+
+// Mentions returns the distinct usernames mentioned in content, lower case
+func Mentions(content string) []string {
+    var names []string
+    seen := map[string]bool{}
+    for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+        name := strings.ToLower(match[1])
+        if !seen[name] {
+            seen[name] = true
+            names = append(names, name)
+        }
+    }
+    return names
+}
+
+// Targets resolves who content by authorID is aimed at: replyToID, the
+// author of the post or comment it replies to (0 for none), and every
+// mentioned user. Authors never target themselves, and a user who is both
+// replied to and mentioned counts once.
+func Targets(db *gorm.DB, authorID uint, content string, replyToID uint) ([]Target, error) {
+    targets := []Target{}
+    seen := map[uint]bool{authorID: true}
+    if replyToID != 0 && !seen[replyToID] {
+        seen[replyToID] = true
+        targets = append(targets, Target{UserID: replyToID, Kind: models.InteractionReply})
+    }
+
+    names := Mentions(content)
+    if len(names) == 0 {
+        return targets, nil
+    }
+    var users []models.User
+    if err := db.Where("username IN ?", names).Order("id").Find(&users).Error; err != nil {
+        return nil, err
+    }
+    for _, user := range users {
+        if !seen[user.ID] {
+            seen[user.ID] = true
+            targets = append(targets, Target{UserID: user.ID, Kind: models.InteractionMention})
+        }
+    }
+    return targets, nil
+}
+
+// Signal describes the interactions toward one target within the window,
+// including the content being checked
+type Signal struct {
+    TargetID uint `json:"target_id"`
+    // Contacts are the author's interactions with the target
+    Contacts int `json:"contacts"`
+    // Repeats are the author's negative interactions with the target
+    Repeats int `json:"repeats"`
+    // Authors are the distinct authors with negative interactions toward
+    // the target
+    Authors     int  `json:"authors"`
+    Repeated    bool `json:"repeated"`
+    Coordinated bool `json:"coordinated"`
+}
+
+// Detected reports whether the target is being harassed
+func (s Signal) Detected() bool {
+    return s.Repeated || s.Coordinated
+}
+
+// Assessment is the outcome of checking one post or comment
+type Assessment struct {
+    Negative bool     `json:"negative"`
+    Signals  []Signal `json:"signals"`
+}
+
+// Detected reports whether the content is part of a harassment pattern
+func (a Assessment) Detected() bool {
+    for _, signal := range a.Signals {
+        if signal.Detected() {
+            return true
+        }
+    }
+    return false
+}
+
+// detectedFor reports whether the content is part of a pattern against
+// target
+func (a Assessment) detectedFor(targetID uint) bool {
+    for _, signal := range a.Signals {
+        if signal.TargetID == targetID && signal.Detected() {
+            return true
+        }
+    }
+    return false
+}
+
+// Values turns the assessment into policy signals. repeated_target is the
+// number of interactions of the author with the target they single out,
+// coordinated_target the number of authors piling onto one target, and
+// targeted_harassment is 1 when either holds.
+func (a Assessment) Values() map[string]float64 {
+    values := map[string]float64{}
+    for _, signal := range a.Signals {
+        if signal.Repeated {
+            values["repeated_target"] = max(values["repeated_target"], float64(signal.Contacts))
+        }
+        if signal.Coordinated {
+            values["coordinated_target"] = max(values["coordinated_target"], float64(signal.Authors))
+        }
+    }
+    if a.Detected() {
+        values["targeted_harassment"] = 1
+    }
+    return values
+}
+
+// Assess checks content by authorID aimed at targets against the
+// interactions of the window ending at now. Interactions the source already
+// has, from before an edit, are left out.
+func Assess(db *gorm.DB, settings Settings, authorID uint, targets []Target, negative bool, source Source, now time.Time) (Assessment, error) {
+    assessment := Assessment{Negative: negative, Signals: []Signal{}}
+    since := now.Add(-settings.Window)
+
+    for _, target := range targets {
+        var counts struct {
+            Contacts int
+            Repeats  int
+        }
+        query := db.Model(&models.Interaction{}).
+            Select("COUNT(*) AS contacts, COUNT(*) FILTER (WHERE negative) AS repeats").
+            Where("actor_id = ? AND target_id = ? AND created_at > ?", authorID, target.UserID, since)
+        if err := source.exclude(query).Scan(&counts).Error; err != nil {
+            return assessment, err
+        }
+
+        var others int64
+        query = db.Model(&models.Interaction{}).
+            Where("target_id = ? AND actor_id <> ? AND negative AND created_at > ?", target.UserID, authorID, since)
+        err := source.exclude(query).Distinct("actor_id").Count(&others).Error
+        if err != nil {
+            return assessment, err
+        }
+
+        signal := Signal{
+            TargetID: target.UserID,
+            Contacts: counts.Contacts + 1,
+            Repeats:  counts.Repeats,
+            Authors:  int(others),
+        }
+        if negative {
+            signal.Repeats++
+        }
+        if signal.Repeats > 0 {
+            signal.Authors++
+        }
+        // A kind message in between does not continue a pattern, a flood does
+        signal.Repeated = (negative && signal.Repeats >= settings.Repeats) || signal.Contacts >= settings.Flood
+        signal.Coordinated = negative && signal.Authors >= settings.GroupSize
+        assessment.Signals = append(assessment.Signals, signal)
+    }
+    return assessment, nil
+}
+
+// Record stores the interactions of a post or comment, replacing those it
+// had before an edit. base carries the author, the post or comment, its
+// toxicity score and the time it was created, which the interactions keep
+// so editing does not move content into a later window.
+func Record(tx *gorm.DB, base models.Interaction, targets []Target, assessment Assessment) error {
+    existing := tx.Where("post_id = ?", base.PostID)
+    if base.CommentID != nil {
+        existing = tx.Where("comment_id = ?", *base.CommentID)
+    }
+    if err := existing.Delete(&models.Interaction{}).Error; err != nil {
+        return err
+    }
+    for _, target := range targets {
+        interaction := base
+        interaction.TargetID = target.UserID
+        interaction.Kind = target.Kind
+        interaction.Negative = assessment.Negative
+        interaction.Pattern = assessment.detectedFor(target.UserID)
+        if err := tx.Create(&interaction).Error; err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Message is a post or comment of a conversation
+type Message struct {
+    Source
+    AuthorID      uint
+    Content       string
+    ToxicityScore int
+    CreatedAt     time.Time
+}
+
+// Conversation returns up to limit recent posts and comments exchanged
+// between authorID and targets within the window ending at now, oldest
+// first: content by the author aimed at one of them and content by them
+// aimed at the author. The sources in exclude, e.g. the content being
+// edited, are left out.
+func Conversation(db *gorm.DB, settings Settings, authorID uint, targets []Target, exclude []Source, now time.Time, limit int) ([]Message, error) {
+    if len(targets) == 0 {
+        return []Message{}, nil
+    }
+    ids := make([]uint, 0, len(targets))
+    for _, target := range targets {
+        ids = append(ids, target.UserID)
+    }
+
+    var sources []Source
+    err := db.Model(&models.Interaction{}).
+        Select("DISTINCT post_id, COALESCE(comment_id, 0) AS comment_id").
+        Where("(actor_id = ? AND target_id IN ?) OR (actor_id IN ? AND target_id = ?)", authorID, ids, ids, authorID).
+        Where("created_at > ?", now.Add(-settings.Window)).
+        Scan(&sources).Error
+    if err != nil {
+        return nil, err
+    }
+    var postIDs, commentIDs []uint
+    for _, source := range sources {
+        switch {
+        case slices.Contains(exclude, source):
+        case source.CommentID != 0:
+            commentIDs = append(commentIDs, source.CommentID)
+        default:
+            postIDs = append(postIDs, source.PostID)
+        }
+    }
+
+    messages := []Message{}
+    if len(postIDs) > 0 {
+        var posts []models.Post
+        err := db.Unscoped().Where("id IN ?", postIDs).Order("created_at DESC").Limit(limit).Find(&posts).Error
+        if err != nil {
+            return nil, err
+        }
+        for _, post := range posts {
+            messages = append(messages, Message{
+                Source:        Source{PostID: post.ID},
+                AuthorID:      post.UserID,
+                Content:       post.Content,
+                ToxicityScore: post.ToxicityScore,
+                CreatedAt:     post.CreatedAt,
+            })
+        }
+    }
+    if len(commentIDs) > 0 {
+        var comments []models.Comment
+        err := db.Unscoped().Where("id IN ?", commentIDs).Order("created_at DESC").Limit(limit).Find(&comments).Error
+        if err != nil {
+            return nil, err
+        }
+        for _, comment := range comments {
+            messages = append(messages, Message{
+                Source:        Source{CommentID: comment.ID},
+                AuthorID:      comment.UserID,
+                Content:       comment.Content,
+                ToxicityScore: comment.ToxicityScore,
+                CreatedAt:     comment.CreatedAt,
+            })
+        }
+    }
+
+    sort.SliceStable(messages, func(i, j int) bool {
+        return messages[i].CreatedAt.Before(messages[j].CreatedAt)
+    })
+    return messages[max(len(messages)-limit, 0):], nil
+}
+
+// AuthorCount sums up one author's interactions with a target
+type AuthorCount struct {
+    ActorID  uint `json:"actor_id"`
+    Contacts int  `json:"contacts"`
+    Negative int  `json:"negative"`
+    Repeated bool `json:"repeated"`
+}
+
+// Pattern is a target singled out within the window and who is aiming at
+// them, most active first
+type Pattern struct {
+    TargetID    uint          `json:"target_id"`
+    Contacts    int           `json:"contacts"`
+    Coordinated bool          `json:"coordinated"`
+    Authors     []AuthorCount `json:"authors"`
+}
+
+// Patterns lists the targets of a harassment pattern in the window ending
+// at now, the most contacted first. targetID limits the list to one target
+// when it is not 0.
+func Patterns(db *gorm.DB, settings Settings, targetID uint, now time.Time) ([]Pattern, error) {
+    query := db.Model(&models.Interaction{}).
+        Select("actor_id, target_id, COUNT(*) AS contacts, COUNT(*) FILTER (WHERE negative) AS negative").
+        Where("created_at > ?", now.Add(-settings.Window))
+    if targetID != 0 {
+        query = query.Where("target_id = ?", targetID)
+    }
+    var rows []struct {
+        ActorID  uint
+        TargetID uint
+        Contacts int
+        Negative int
+    }
+    if err := query.Group("actor_id, target_id").Order("contacts DESC, actor_id").Scan(&rows).Error; err != nil {
+        return nil, err
+    }
+
+    byTarget := map[uint]*Pattern{}
+    negativeAuthors := map[uint]int{}
+    var order []uint
+    for _, row := range rows {
+        pattern, ok := byTarget[row.TargetID]
+        if !ok {
+            pattern = &Pattern{TargetID: row.TargetID}
+            byTarget[row.TargetID] = pattern
+            order = append(order, row.TargetID)
+        }
+        pattern.Contacts += row.Contacts
+        pattern.Authors = append(pattern.Authors, AuthorCount{
+            ActorID:  row.ActorID,
+            Contacts: row.Contacts,
+            Negative: row.Negative,
+            Repeated: row.Negative >= settings.Repeats || row.Contacts >= settings.Flood,
+        })
+        if row.Negative > 0 {
+            negativeAuthors[row.TargetID]++
+        }
+    }
+
+    patterns := []Pattern{}
+    for _, id := range order {
+        pattern := byTarget[id]
+        pattern.Coordinated = negativeAuthors[id] >= settings.GroupSize
+        repeated := false
+        for _, author := range pattern.Authors {
+            repeated = repeated || author.Repeated
+        }
+        if repeated || pattern.Coordinated {
+            patterns = append(patterns, *pattern)
+        }
+    }
+    sort.SliceStable(patterns, func(i, j int) bool {
+        return patterns[i].Contacts > patterns[j].Contacts
+    })
+    return patterns, nil
+}
@@ -0,0 +1,370 @@
+// Package lexicon loads the toxicity word lists from versioned JSON files
+// and keeps a compiled matcher for them that can be swapped at runtime.
+//
+// A lexicon file looks like:
+//
+//    {
+//      "name": "core",
+//      "version": "1.0.0",
+//      "language": "en",
+//      "entries": [
+//        {"term": "kill*", "category": "threat", "weight": 1, "severity": "medium"},
+//        {"term": "stupid*", "category": "insult", "alternatives": ["unwise"]}
+//      ],
+//      "allow": ["killer whale*"]
+//    }
+//
+// Categories use the canonical keys from services (obscene, insult, threat,
+// identity_hate, ...). Terms follow the matcher syntax. Alternatives are
+// softer wordings offered to users before they post.
+//
+// Moderators can add custom block and allow terms on top of the files with
+// SetCustomTerms. They are compiled into the same matcher, and also into a
+// separate Custom matcher used to override model results.
+package lexicon
+
+import (
+    "embed"
+    "encoding/json"
+    "fmt"
+    "io/fs"
+    "log"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/elham-abdu/cyberbullyprevention/matcher"
+)
+
+//go:embed data/*.json
+var builtin embed.FS
+
+// Entry is one term of a lexicon file
+type Entry struct {
+    Term         string   `json:"term"`
+    Category     string   `json:"category"`
+    Weight       float64  `json:"weight"`
+    Language     string   `json:"language,omitempty"`
+    Severity     string   `json:"severity,omitempty"`
+    Alternatives []string `json:"alternatives,omitempty"`
+    // Source is the name of the file the entry came from
+    Source string `json:"-"`
+}
+
+// File is the on-disk format of a lexicon
+type File struct {
+    Name     string   `json:"name"`
+    Version  string   `json:"version"`
+    Language string   `json:"language"`
+    Entries  []Entry  `json:"entries"`
+    Allow    []string `json:"allow"`
+}
+
+// FileInfo describes a loaded lexicon file
+type FileInfo struct {
+    Name     string `json:"name"`
+    Version  string `json:"version"`
+    Language string `json:"language"`
+    Entries  int    `json:"entries"`
+    Path     string `json:"path"`
+}
+
+// Lexicon is an immutable, compiled set of lexicon files
+type Lexicon struct {
+    Version  string     `json:"version"`
+    Source   string     `json:"source"`
+    Files    []FileInfo `json:"files"`
+    Entries  []Entry    `json:"-"`
+    Allow    []string   `json:"-"`
+    LoadedAt time.Time  `json:"loaded_at"`
+
+    CustomVersion string   `json:"custom_version,omitempty"`
+    CustomEntries []Entry  `json:"custom_entries"`
+    CustomAllow   []string `json:"custom_allow"`
+
+    // Matcher finds file and custom terms
+    Matcher *matcher.Matcher `json:"-"`
+    // Custom finds only the custom terms
+    Custom *matcher.Matcher `json:"-"`
+    // Allowed finds the custom allowed terms
+    Allowed *matcher.Matcher `json:"-"`
+
+    // alternatives indexes entry alternatives by lowercased term
+    alternatives map[string][]string
+}
+
+var (
+    active atomic.Pointer[Lexicon]
+    // dir is the directory lexicons are loaded from, "" for the built-in set
+    dir    string
+    reload sync.Mutex
+
+    // custom terms survive file reloads
+    customVersion string
+    customEntries []Entry
+    customAllow   []string
+)
+
+// Init loads the lexicons from directory, or the built-in lexicons when
+// directory is empty or cannot be loaded
+func Init(directory string) {
+    reload.Lock()
+    defer reload.Unlock()
+
+    dir = directory
+    lex, err := load(dir)
+    if err != nil {
+        log.Printf("Failed to load lexicons from %q, using built-in lexicons: %v", dir, err)
+        dir = ""
+        lex, err = load("")
+        if err != nil {
+            log.Fatal("Failed to load built-in lexicons:", err)
+        }
+    }
+
+    active.Store(lex)
+    log.Printf("Lexicon version %s loaded from %s", lex.Version, lex.Source)
+}
+
+// Active returns the lexicon currently in use
+func Active() *Lexicon {
+    lex := active.Load()
+    if lex == nil {
+        Init("")
+        lex = active.Load()
+    }
+    return lex
+}
+
+// Reload loads the lexicon files again and swaps them in. The previous
+// lexicon stays active when loading fails.
+func Reload() (*Lexicon, error) {
+    reload.Lock()
+    defer reload.Unlock()
+
+    lex, err := load(dir)
+    if err != nil {
+        return nil, err
+    }
+
+    active.Store(lex)
+    log.Printf("Lexicon version %s reloaded from %s", lex.FullVersion(), lex.Source)
+    return lex, nil
+}
+
+// Watch polls the lexicon directory and reloads when a file changes. It
+// blocks, so run it in its own goroutine.
+func Watch(interval time.Duration) {
+    reload.Lock()
+    directory := dir
+    reload.Unlock()
+    if directory == "" {
+        return
+    }
+
+    last := fingerprint(directory)
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for range ticker.C {
+        current := fingerprint(directory)
+        if current == last {
+            continue
+        }
+        if _, err := Reload(); err != nil {
+            log.Printf("Lexicon reload failed, keeping version %s: %v", Active().Version, err)
+            continue
+        }
+        last = current
+    }
+}
+
+// fingerprint summarizes the names, sizes and modification times of the
+// lexicon files in directory
+func fingerprint(directory string) string {
+    paths, _ := filepath.Glob(filepath.Join(directory, "*.json"))
+    sort.Strings(paths)
+
+    var b strings.Builder
+    for _, path := range paths {
+        info, err := os.Stat(path)
+        if err != nil {
+            continue
+        }
+        fmt.Fprintf(&b, "%s:%d:%d;", path, info.Size(), info.ModTime().UnixNano())
+    }
+    return b.String()
+}
+
+// load reads and compiles every lexicon file in directory
+func load(directory string) (*Lexicon, error) {
+    var fsys fs.FS = builtin
+    pattern := "data/*.json"
+    source := "built-in"
+    if directory != "" {
+        fsys = os.DirFS(directory)
+        pattern = "*.json"
+        source = directory
+    }
+
+    paths, err := fs.Glob(fsys, pattern)
+    if err != nil {
+        return nil, err
+    }
+    if len(paths) == 0 {
+        return nil, fmt.Errorf("no lexicon files found")
+    }
+    sort.Strings(paths)
+
+    lex := &Lexicon{Source: source, LoadedAt: time.Now()}
+    versions := []string{}
+    for _, path := range paths {
+        data, err := fs.ReadFile(fsys, path)
+        if err != nil {
+            return nil, err
+        }
+
+        var file File
+        if err := json.Unmarshal(data, &file); err != nil {
+            return nil, fmt.Errorf("%s: %v", path, err)
+        }
+        if file.Name == "" || file.Version == "" {
+            return nil, fmt.Errorf("%s: name and version are required", path)
+        }
+
+        for i, entry := range file.Entries {
+            if strings.TrimSpace(entry.Term) == "" || entry.Category == "" {
+                return nil, fmt.Errorf("%s: entry %d needs a term and a category", path, i)
+            }
+            if entry.Weight <= 0 {
+                entry.Weight = 1
+            }
+            if entry.Language == "" {
+                entry.Language = file.Language
+            }
+            entry.Source = file.Name
+            lex.Entries = append(lex.Entries, entry)
+        }
+        lex.Allow = append(lex.Allow, file.Allow...)
+
+        lex.Files = append(lex.Files, FileInfo{
+            Name:     file.Name,
+            Version:  file.Version,
+            Language: file.Language,
+            Entries:  len(file.Entries),
+            Path:     path,
+        })
+        versions = append(versions, file.Name+"@"+file.Version)
+    }
+
+    lex.Version = strings.Join(versions, "+")
+    lex.CustomVersion = customVersion
+    lex.CustomEntries = customEntries
+    lex.CustomAllow = customAllow
+    if err := compile(lex); err != nil {
+        return nil, err
+    }
+    return lex, nil
+}
+
+// compile builds the matchers of a lexicon
+func compile(lex *Lexicon) error {
+    all := append(matcherEntries(lex.Entries), matcherEntries(lex.CustomEntries)...)
+    allow := append(append([]string{}, lex.Allow...), lex.CustomAllow...)
+
+    var err error
+    lex.Matcher, err = matcher.Compile(all, allow)
+    if err != nil {
+        return err
+    }
+    lex.Custom, err = matcher.Compile(matcherEntries(lex.CustomEntries), lex.CustomAllow)
+    if err != nil {
+        return err
+    }
+    allowed := make([]matcher.Entry, 0, len(lex.CustomAllow))
+    for _, term := range lex.CustomAllow {
+        allowed = append(allowed, matcher.Entry{Term: term, Category: "allow", Weight: 1})
+    }
+    lex.Allowed, err = matcher.Compile(allowed, nil)
+    if err != nil {
+        return err
+    }
+
+    lex.alternatives = map[string][]string{}
+    for _, entry := range append(append([]Entry{}, lex.Entries...), lex.CustomEntries...) {
+        if len(entry.Alternatives) > 0 {
+            key := strings.ToLower(strings.TrimSpace(entry.Term))
+            lex.alternatives[key] = append(lex.alternatives[key], entry.Alternatives...)
+        }
+    }
+    return nil
+}
+
+// Alternatives returns the softer wordings listed for term
+func (l *Lexicon) Alternatives(term string) []string {
+    return l.alternatives[strings.ToLower(strings.TrimSpace(term))]
+}
+
+// FullVersion returns the file version plus the custom terms version
+func (l *Lexicon) FullVersion() string {
+    if l.CustomVersion == "" {
+        return l.Version
+    }
+    return l.Version + "+custom@" + l.CustomVersion
+}
+
+// SetCustomTerms replaces the moderator-managed terms and recompiles the
+// active lexicon. version identifies the set of custom terms.
+func SetCustomTerms(version string, entries []Entry, allow []string) error {
+    reload.Lock()
+    defer reload.Unlock()
+
+    for i := range entries {
+        if entries[i].Weight <= 0 {
+            entries[i].Weight = 1
+        }
+        if entries[i].Source == "" {
+            entries[i].Source = "custom"
+        }
+    }
+
+    base := active.Load()
+    if base == nil {
+        var err error
+        if base, err = load(dir); err != nil {
+            return err
+        }
+    }
+
+    current := *base
+    current.CustomVersion = version
+    current.CustomEntries = entries
+    current.CustomAllow = allow
+    if err := compile(&current); err != nil {
+        return err
+    }
+
+    customVersion, customEntries, customAllow = version, entries, allow
+    active.Store(&current)
+    log.Printf("Lexicon custom terms updated to version %s (%d blocked, %d allowed)", version, len(entries), len(allow))
+    return nil
+}
+
+// matcherEntries converts lexicon entries into matcher entries
+func matcherEntries(entries []Entry) []matcher.Entry {
+    out := make([]matcher.Entry, 0, len(entries))
+    for _, entry := range entries {
+        out = append(out, matcher.Entry{
+            Term:     entry.Term,
+            Category: entry.Category,
+            Weight:   entry.Weight,
+            Severity: entry.Severity,
+            Source:   "lexicon:" + entry.Source,
+        })
+    }
+    return out
+}
@@ -3,17 +3,72 @@
 import (
     "log"
     "net/http"
+    "strconv"
+    "time"
 
     "github.com/elham-abdu/cyberbullyprevention/config"
+    "github.com/elham-abdu/cyberbullyprevention/lexicon"
     "github.com/elham-abdu/cyberbullyprevention/models"
+    "github.com/elham-abdu/cyberbullyprevention/moderation"
     "github.com/elham-abdu/cyberbullyprevention/handlers"
     "github.com/elham-abdu/cyberbullyprevention/middleware"
+    "github.com/elham-abdu/cyberbullyprevention/retention"
+    "github.com/elham-abdu/cyberbullyprevention/services"
 )
 
 func main() {
     config.LoadEnv()
     config.ConnectDB()
-    config.DB.AutoMigrate(&models.User{}, &models.Post{})
+    config.DB.AutoMigrate(
+        &models.User{},
+        &models.Post{},
+        &models.PostAnalysis{},
+        &models.PostRevision{},
+        &models.LexiconTerm{},
+        &models.LexiconTermAudit{},
+        &models.PolicyVersion{},
+        &models.ModerationQueueItem{},
+        &models.QueueSkip{},
+        &models.ModerationAction{},
+        &models.ViolationReason{},
+        &models.Appeal{},
+        &models.Strike{},
+        &models.Sanction{},
+        &models.Interaction{},
+        &models.Comment{},
+        &models.Follow{},
+        &models.Block{},
+        &models.Mute{},
+    )
+    if err := moderation.EnsureAppendOnly(config.DB); err != nil {
+        log.Printf("Failed to protect the moderation audit log: %v", err)
+    }
+    lexicon.Init(config.GetEnvOrDefault("LEXICON_DIR", ""))
+    services.InitPipeline()
+    if err := handlers.SyncCustomLexicon(); err != nil {
+        log.Printf("Failed to load custom lexicon terms: %v", err)
+    }
+    if err := handlers.SyncViolationReasons(); err != nil {
+        log.Printf("Failed to seed violation reasons: %v", err)
+    }
+    if err := handlers.SyncPolicy(); err != nil {
+        log.Printf("Failed to load moderation policy, using built-in rules: %v", err)
+    }
+    if queued, err := moderation.Backfill(config.DB); err != nil {
+        log.Printf("Failed to queue flagged posts for moderation: %v", err)
+    } else if queued > 0 {
+        log.Printf("Queued %d flagged posts for moderation", queued)
+    }
+
+    // Reload lexicon files when they change on disk
+    watchSeconds, err := strconv.Atoi(config.GetEnvOrDefault("LEXICON_WATCH_SECONDS", "10"))
+    if err != nil || watchSeconds <= 0 {
+        watchSeconds = 10
+    }
+    go lexicon.Watch(time.Duration(watchSeconds) * time.Second)
+
+    // Purge soft-deleted posts once their retention period is over
+    go retention.Run(time.Hour)
 
     // Create a new serve mux
     mux := http.NewServeMux()
@@ -24,10 +79,31 @@ func main() {
 
     // Protected routes
     mux.Handle("/me", middleware.JWTAuth(http.HandlerFunc(handlers.Me)))
+    mux.Handle("/me/username", middleware.JWTAuth(http.HandlerFunc(handlers.SetUsername)))
     mux.Handle("/me/posts", middleware.JWTAuth(http.HandlerFunc(handlers.GetMyPosts)))
-    mux.Handle("/me/posts/create", middleware.JWTAuth(http.HandlerFunc(handlers.CreatePost)))
-    mux.Handle("/me/posts/edit", middleware.JWTAuth(http.HandlerFunc(handlers.EditPost)))
+    mux.Handle("/me/posts/create", middleware.JWTAuth(middleware.PostingCooldown(http.HandlerFunc(handlers.CreatePost))))
+    mux.Handle("/me/posts/check", middleware.JWTAuth(http.HandlerFunc(handlers.CheckPost)))
+    mux.Handle("/me/posts/edit", middleware.JWTAuth(middleware.PostingCooldown(http.HandlerFunc(handlers.EditPost))))
     mux.Handle("/me/posts/delete", middleware.JWTAuth(http.HandlerFunc(handlers.DeletePost)))
+    mux.Handle("/comments", middleware.JWTAuth(http.HandlerFunc(handlers.GetComments)))
+    mux.Handle("/feed", middleware.JWTAuth(http.HandlerFunc(handlers.GetFeed)))
+    mux.Handle("/feed/following", middleware.JWTAuth(http.HandlerFunc(handlers.GetFollowingFeed)))
+    mux.Handle("/users/posts", middleware.JWTAuth(http.HandlerFunc(handlers.GetUserFeed)))
+    mux.Handle("/me/follows", middleware.JWTAuth(http.HandlerFunc(handlers.GetFollows)))
+    mux.Handle("/me/follows/create", middleware.JWTAuth(http.HandlerFunc(handlers.Follow)))
+    mux.Handle("/me/follows/delete", middleware.JWTAuth(http.HandlerFunc(handlers.Unfollow)))
+    mux.Handle("/me/blocks", middleware.JWTAuth(http.HandlerFunc(handlers.GetBlocks)))
+    mux.Handle("/me/blocks/create", middleware.AllowSanctioned(middleware.JWTAuth(http.HandlerFunc(handlers.BlockUser))))
+    mux.Handle("/me/blocks/delete", middleware.JWTAuth(http.HandlerFunc(handlers.UnblockUser)))
+    mux.Handle("/me/mutes", middleware.JWTAuth(http.HandlerFunc(handlers.GetMutes)))
+    mux.Handle("/me/mutes/create", middleware.AllowSanctioned(middleware.JWTAuth(http.HandlerFunc(handlers.MuteUser))))
+    mux.Handle("/me/mutes/delete", middleware.JWTAuth(http.HandlerFunc(handlers.UnmuteUser)))
+    mux.Handle("/me/comments/create", middleware.JWTAuth(middleware.PostingCooldown(http.HandlerFunc(handlers.CreateComment))))
+    mux.Handle("/me/comments/edit", middleware.JWTAuth(middleware.PostingCooldown(http.HandlerFunc(handlers.EditComment))))
+    mux.Handle("/me/comments/delete", middleware.JWTAuth(http.HandlerFunc(handlers.DeleteComment)))
+    mux.Handle("/me/moderation", middleware.JWTAuth(http.HandlerFunc(handlers.GetMyModeration)))
+    mux.Handle("/me/appeals", middleware.JWTAuth(http.HandlerFunc(handlers.GetMyAppeals)))
+    mux.Handle("/me/appeals/create", middleware.AllowSanctioned(middleware.JWTAuth(http.HandlerFunc(handlers.CreateAppeal))))
     
     // Admin routes
     mux.Handle("/admin/dashboard", 
@@ -44,6 +120,20 @@ func main() {
             ),
         ),
     )
+    mux.Handle("/admin/posts/transition",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.TransitionPost),
+            ),
+        ),
+    )
+    mux.Handle("/admin/comments/transition",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.TransitionComment),
+            ),
+        ),
+    )
     mux.Handle("/admin/posts/mark-safe",
         middleware.JWTAuth(
             middleware.RoleAuth("admin")(
@@ -58,12 +148,236 @@ func main() {
             ),
         ),
     )
+    mux.Handle("/admin/posts/deleted",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.GetDeletedPosts),
+            ),
+        ),
+    )
+    mux.Handle("/admin/posts/restore",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.RestorePost),
+            ),
+        ),
+    )
+    mux.Handle("/admin/posts/revisions",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.GetPostRevisions),
+            ),
+        ),
+    )
+    mux.Handle("/admin/posts/revisions/diff",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.DiffPostRevisions),
+            ),
+        ),
+    )
+    mux.Handle("/admin/lexicon",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.GetLexicon),
+            ),
+        ),
+    )
+    mux.Handle("/admin/lexicon/reload",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.ReloadLexicon),
+            ),
+        ),
+    )
+    mux.Handle("/admin/lexicon/terms",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.GetLexiconTerms),
+            ),
+        ),
+    )
+    mux.Handle("/admin/lexicon/terms/create",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.CreateLexiconTerm),
+            ),
+        ),
+    )
+    mux.Handle("/admin/lexicon/terms/update",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.UpdateLexiconTerm),
+            ),
+        ),
+    )
+    mux.Handle("/admin/lexicon/terms/delete",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.DeleteLexiconTerm),
+            ),
+        ),
+    )
+    mux.Handle("/admin/lexicon/terms/audit",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.GetLexiconTermAudit),
+            ),
+        ),
+    )
+    mux.Handle("/admin/policy",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.GetPolicy),
+            ),
+        ),
+    )
+    mux.Handle("/admin/policy/update",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.UpdatePolicy),
+            ),
+        ),
+    )
+    mux.Handle("/admin/policy/versions",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.GetPolicyVersions),
+            ),
+        ),
+    )
+    mux.Handle("/admin/policy/activate",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.ActivatePolicyVersion),
+            ),
+        ),
+    )
+    mux.Handle("/admin/queue",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.GetModerationQueue),
+            ),
+        ),
+    )
+    mux.Handle("/admin/queue/next",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.NextQueueItem),
+            ),
+        ),
+    )
+    mux.Handle("/admin/queue/claim",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.ClaimQueueItem),
+            ),
+        ),
+    )
+    mux.Handle("/admin/queue/release",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.ReleaseQueueItem),
+            ),
+        ),
+    )
+    mux.Handle("/admin/queue/skip",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.SkipQueueItem),
+            ),
+        ),
+    )
+    mux.Handle("/admin/queue/reassign",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.ReassignQueueItem),
+            ),
+        ),
+    )
+    mux.Handle("/admin/appeals",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.GetAppeals),
+            ),
+        ),
+    )
+    mux.Handle("/admin/appeals/decide",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.DecideAppeal),
+            ),
+        ),
+    )
+    mux.Handle("/admin/users/strikes",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.GetUserStrikes),
+            ),
+        ),
+    )
+    mux.Handle("/admin/users/sanctions/lift",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.LiftSanction),
+            ),
+        ),
+    )
+    mux.Handle("/admin/harassment",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.GetHarassmentPatterns),
+            ),
+        ),
+    )
+    mux.Handle("/admin/audit",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.GetModerationAudit),
+            ),
+        ),
+    )
+    mux.Handle("/admin/cases/export",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.ExportCase),
+            ),
+        ),
+    )
+    mux.Handle("/admin/reasons",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.GetViolationReasons),
+            ),
+        ),
+    )
+    mux.Handle("/admin/reasons/create",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.CreateViolationReason),
+            ),
+        ),
+    )
+    mux.Handle("/admin/reasons/update",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.UpdateViolationReason),
+            ),
+        ),
+    )
+    mux.Handle("/admin/analytics/reasons",
+        middleware.JWTAuth(
+            middleware.RoleAuth("admin")(
+                http.HandlerFunc(handlers.GetReasonAnalytics),
+            ),
+        ),
+    )
 
     // Wrap the mux with CORS middleware
     handler := middleware.CorsMiddleware(mux)
 
     log.Println("Server running on :8080")
-    err := http.ListenAndServe(":8080", handler)
+    err = http.ListenAndServe(":8080", handler)
     if err != nil {
         log.Fatal("Server failed:", err)
     }
@@ -0,0 +1,297 @@
+// Package matcher finds lexicon terms in text with an Aho-Corasick
+// automaton, so matching stays linear in the length of the text no matter
+// how many terms there are.
+//
+// Terms only match on word boundaries: "hell" does not match "hello" and
+// "ass" does not match "class". A term ending in "*" is a stem and matches
+// any word starting with it ("kill*" matches "killing" but still not
+// "skill"). Terms may span several words ("beat you up"); any run of
+// whitespace in the text matches a single space in the term. Allowed terms
+// suppress every match that falls inside them.
+package matcher
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+)
+
+// Entry is a term to look for
+type Entry struct {
+    Term     string
+    Category string
+    Weight   float64
+    Severity string
+    // Source names where the term came from, e.g. a lexicon file
+    Source string
+}
+
+// Match is one occurrence of an entry in the text
+type Match struct {
+    Entry
+    // Start and End are byte offsets into the searched text
+    Start int
+    End   int
+    // Text is the matched text, extended to the whole word for stems
+    Text string
+}
+
+// node is a state of the automaton
+type node struct {
+    next map[byte]int
+    fail int
+    // outputs are indexes into Matcher.patterns ending at this state
+    outputs []int
+}
+
+// pattern is a compiled term
+type pattern struct {
+    text    string
+    entry   int // index into entries, -1 for allowed terms
+    stem    bool
+    allowed bool
+}
+
+// Matcher is a compiled, read-only set of terms, safe for concurrent use
+type Matcher struct {
+    nodes    []node
+    patterns []pattern
+    entries  []Entry
+}
+
+// Compile builds a matcher from block entries and allowed terms
+func Compile(entries []Entry, allowed []string) (*Matcher, error) {
+    m := &Matcher{
+        nodes:   []node{{next: map[byte]int{}}},
+        entries: entries,
+    }
+
+    for i, entry := range entries {
+        text, stem := prepareTerm(entry.Term)
+        if text == "" {
+            return nil, fmt.Errorf("empty term in entry %d", i)
+        }
+        m.add(pattern{text: text, entry: i, stem: stem})
+    }
+    for _, term := range allowed {
+        text, stem := prepareTerm(term)
+        if text == "" {
+            continue
+        }
+        m.add(pattern{text: text, entry: -1, stem: stem, allowed: true})
+    }
+
+    m.build()
+    return m, nil
+}
+
+// MustCompile is like Compile but panics on error
+func MustCompile(entries []Entry, allowed []string) *Matcher {
+    m, err := Compile(entries, allowed)
+    if err != nil {
+        panic(err)
+    }
+    return m
+}
+
+// prepareTerm lowercases a term, collapses its whitespace and strips the
+// stem marker
+func prepareTerm(term string) (string, bool) {
+    term = strings.ToLower(strings.Join(strings.Fields(term), " "))
+    stem := strings.HasSuffix(term, "*")
+    return strings.TrimSpace(strings.TrimSuffix(term, "*")), stem
+}
+
+// add inserts a pattern into the trie
+func (m *Matcher) add(p pattern) {
+    state := 0
+    for i := 0; i < len(p.text); i++ {
+        next, ok := m.nodes[state].next[p.text[i]]
+        if !ok {
+            m.nodes = append(m.nodes, node{next: map[byte]int{}})
+            next = len(m.nodes) - 1
+            m.nodes[state].next[p.text[i]] = next
+        }
+        state = next
+    }
+    m.patterns = append(m.patterns, p)
+    m.nodes[state].outputs = append(m.nodes[state].outputs, len(m.patterns)-1)
+}
+
+// build computes failure links breadth first
+func (m *Matcher) build() {
+    queue := []int{}
+    for _, child := range m.nodes[0].next {
+        m.nodes[child].fail = 0
+        queue = append(queue, child)
+    }
+
+    for len(queue) > 0 {
+        state := queue[0]
+        queue = queue[1:]
+
+        for b, child := range m.nodes[state].next {
+            queue = append(queue, child)
+
+            fail := m.nodes[state].fail
+            for fail != 0 {
+                if _, ok := m.nodes[fail].next[b]; ok {
+                    break
+                }
+                fail = m.nodes[fail].fail
+            }
+            if next, ok := m.nodes[fail].next[b]; ok && next != child {
+                m.nodes[child].fail = next
+            } else {
+                m.nodes[child].fail = 0
+            }
+            m.nodes[child].outputs = append(m.nodes[child].outputs, m.nodes[m.nodes[child].fail].outputs...)
+        }
+    }
+}
+
+// Find returns every entry match in text in order of appearance. Matches
+// covered by an allowed term are dropped.
+func (m *Matcher) Find(text string) []Match {
+    folded, offsets := fold(text)
+
+    var found []Match
+    var allowed [][2]int
+
+    state := 0
+    for i := 0; i < len(folded); i++ {
+        b := folded[i]
+        for state != 0 {
+            if _, ok := m.nodes[state].next[b]; ok {
+                break
+            }
+            state = m.nodes[state].fail
+        }
+        if next, ok := m.nodes[state].next[b]; ok {
+            state = next
+        }
+
+        for _, index := range m.nodes[state].outputs {
+            p := m.patterns[index]
+            start := i + 1 - len(p.text)
+            end := i + 1
+            if !isBoundary(folded, start-1) {
+                continue
+            }
+            if p.stem {
+                end = wordEnd(folded, end)
+            } else if !isBoundary(folded, end) {
+                continue
+            }
+
+            origStart, origEnd := offsets[start], offsets[end]
+            if p.allowed {
+                allowed = append(allowed, [2]int{origStart, origEnd})
+                continue
+            }
+            found = append(found, Match{
+                Entry: m.entries[p.entry],
+                Start: origStart,
+                End:   origEnd,
+                Text:  text[origStart:origEnd],
+            })
+        }
+    }
+
+    if len(allowed) == 0 {
+        return sortMatches(found)
+    }
+
+    kept := found[:0]
+    for _, match := range found {
+        covered := false
+        for _, span := range allowed {
+            if span[0] <= match.Start && match.End <= span[1] {
+                covered = true
+                break
+            }
+        }
+        if !covered {
+            kept = append(kept, match)
+        }
+    }
+    return sortMatches(kept)
+}
+
+// fold lowercases text and collapses whitespace runs into one space. The
+// returned offsets map each byte of the folded text (plus one past the end)
+// to a byte offset in text.
+func fold(text string) (string, []int) {
+    var b strings.Builder
+    offsets := make([]int, 0, len(text)+1)
+    lastSpace := false
+
+    for i, r := range text {
+        if unicode.IsSpace(r) {
+            if lastSpace {
+                continue
+            }
+            lastSpace = true
+            b.WriteByte(' ')
+            offsets = append(offsets, i)
+            continue
+        }
+        lastSpace = false
+
+        lower := unicode.ToLower(r)
+        // Keep byte offsets aligned when lowercasing changes the rune length
+        if utf8.RuneLen(lower) != utf8.RuneLen(r) {
+            lower = r
+        }
+        n := b.Len()
+        b.WriteRune(lower)
+        for j := 0; j < b.Len()-n; j++ {
+            offsets = append(offsets, i+j)
+        }
+    }
+    offsets = append(offsets, len(text))
+    return b.String(), offsets
+}
+
+// isBoundary reports whether position i is outside a word
+func isBoundary(text string, i int) bool {
+    if i < 0 || i >= len(text) {
+        return true
+    }
+    r, _ := utf8.DecodeRuneInString(text[i:])
+    if r == utf8.RuneError {
+        // Inside a multi-byte rune, look at its first byte
+        r, _ = utf8.DecodeLastRuneInString(text[:i+1])
+    }
+    return !isWordRune(r)
+}
+
+// wordEnd returns the end of the word containing position i
+func wordEnd(text string, i int) int {
+    for i < len(text) {
+        r, size := utf8.DecodeRuneInString(text[i:])
+        if !isWordRune(r) {
+            break
+        }
+        i += size
+    }
+    return i
+}
+
+// isWordRune reports letters and digits
+func isWordRune(r rune) bool {
+    return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// sortMatches orders matches by position, longest first on ties
+func sortMatches(matches []Match) []Match {
+    sort.SliceStable(matches, func(i, j int) bool {
+        if matches[i].Start != matches[j].Start {
+            return matches[i].Start < matches[j].Start
+        }
+        return matches[i].End > matches[j].End
+    })
+    return matches
+}
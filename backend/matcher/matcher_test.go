@@ -0,0 +1,92 @@
+package matcher
+
+import (
+    "reflect"
+    "testing"
+)
+
+// found lists the matched text of each match, in order
+func found(matches []Match) []string {
+    texts := []string{}
+    for _, match := range matches {
+        texts = append(texts, match.Text)
+    }
+    return texts
+}
+
+func TestFind(t *testing.T) {
+    m := MustCompile([]Entry{
+        {Term: "ass", Category: "obscene"},
+        {Term: "hell", Category: "obscene"},
+        {Term: "die", Category: "threat"},
+        {Term: "kill*", Category: "threat"},
+        {Term: "stupid*", Category: "insult"},
+        {Term: "beat you up", Category: "threat"},
+    }, []string{"killer whale", "hell's kitchen"})
+
+    tests := []struct {
+        name string
+        text string
+        want []string
+    }{
+        // Word boundaries
+        {"whole word", "what an ass", []string{"ass"}},
+        {"inside a word", "first class", []string{}},
+        {"prefix of a word", "hello there", []string{}},
+        {"longer word", "on a diet", []string{}},
+        {"punctuation is a boundary", "go to hell!", []string{"hell"}},
+        {"digits are part of words", "die2 die", []string{"die"}},
+        {"case is ignored", "GO TO HELL", []string{"HELL"}},
+
+        // Stems
+        {"stem on its own", "I will kill you", []string{"kill"}},
+        {"stem extends to the word", "stop killing", []string{"killing"}},
+        {"stem is not a suffix match", "a real skill", []string{}},
+        {"several stems", "stupidest killers", []string{"stupidest", "killers"}},
+
+        // Phrases
+        {"phrase", "I will beat you up", []string{"beat you up"}},
+        {"phrase across whitespace", "beat  you\nup", []string{"beat  you\nup"}},
+        {"partial phrase", "beat you", []string{}},
+
+        // Allowed terms
+        {"allowed phrase", "we saw a killer whale", []string{}},
+        {"allowed phrase with apostrophe", "dinner at hell's kitchen", []string{}},
+        {"stem outside the allowed phrase", "the killer whale will kill", []string{"kill"}},
+        {"allowed phrase needs all its words", "a killer shark", []string{"killer"}},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            if got := found(m.Find(test.text)); !reflect.DeepEqual(got, test.want) {
+                t.Errorf("Find(%q) = %q, want %q", test.text, got, test.want)
+            }
+        })
+    }
+}
+
+func TestFindOffsets(t *testing.T) {
+    m := MustCompile([]Entry{
+        {Term: "idiot", Category: "insult", Weight: 2, Severity: "low", Source: "test"},
+        {Term: "idiot*", Category: "insult"},
+    }, nil)
+
+    // "é" is two bytes, so offsets are bytes and not characters
+    matches := m.Find("café  IDIOTS, idiot")
+    want := []Match{
+        {Entry: Entry{Term: "idiot*", Category: "insult"}, Start: 7, End: 13, Text: "IDIOTS"},
+        {Entry: Entry{Term: "idiot", Category: "insult", Weight: 2, Severity: "low", Source: "test"}, Start: 15, End: 20, Text: "idiot"},
+        {Entry: Entry{Term: "idiot*", Category: "insult"}, Start: 15, End: 20, Text: "idiot"},
+    }
+    if !reflect.DeepEqual(matches, want) {
+        t.Errorf("Find = %+v, want %+v", matches, want)
+    }
+}
+
+func TestCompileRejectsEmptyTerms(t *testing.T) {
+    if _, err := Compile([]Entry{{Term: " * "}}, nil); err == nil {
+        t.Error("Compile accepted an empty term")
+    }
+    if _, err := Compile([]Entry{{Term: "ok"}}, []string{"", "*"}); err != nil {
+        t.Errorf("Compile rejected empty allowed terms: %v", err)
+    }
+}
@@ -65,6 +65,11 @@ func JWTAuth(next http.Handler) http.Handler {
 
 		userID := uint(userIDFloat)
 
+		// Suspended and banned users keep read access only
+		if !checkSanctions(w, r, userID) {
+			return
+		}
+
 		// 6️⃣ Store values in context
 		ctx := context.WithValue(r.Context(), "user_id", userID)
 		ctx = context.WithValue(ctx, "role", role)
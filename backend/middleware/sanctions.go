@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/elham-abdu/cyberbullyprevention/config"
+	"github.com/elham-abdu/cyberbullyprevention/models"
+	"github.com/elham-abdu/cyberbullyprevention/strikes"
+)
+
+// AllowSanctioned lets suspended and banned users reach a write endpoint,
+// e.g. to appeal. It must wrap JWTAuth.
+func AllowSanctioned(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), "sanction_exempt", true)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// PostingCooldown stops users under a posting cooldown from creating or
+// editing content. It must be wrapped by JWTAuth.
+func PostingCooldown(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(uint)
+		sanction, err := strikes.Restriction(config.DB, userID, time.Now(), models.SanctionCooldown)
+		if err != nil {
+			http.Error(w, "Error checking account standing", http.StatusInternalServerError)
+			return
+		}
+		if sanction != nil {
+			http.Error(w, "Posting is paused"+until(sanction), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkSanctions answers false, after writing the response, when a
+// suspended or banned user tries to change something. Reading stays
+// allowed.
+func checkSanctions(w http.ResponseWriter, r *http.Request, userID uint) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	if exempt, _ := r.Context().Value("sanction_exempt").(bool); exempt {
+		return true
+	}
+
+	sanction, err := strikes.Restriction(config.DB, userID, time.Now(), models.SanctionSuspension, models.SanctionBan)
+	if err != nil {
+		http.Error(w, "Error checking account standing", http.StatusInternalServerError)
+		return false
+	}
+	if sanction == nil {
+		return true
+	}
+	if sanction.Kind == models.SanctionBan {
+		http.Error(w, "Account banned", http.StatusForbidden)
+	} else {
+		http.Error(w, "Account suspended"+until(sanction), http.StatusForbidden)
+	}
+	return false
+}
+
+// until describes when a sanction ends
+func until(sanction *models.Sanction) string {
+	if sanction.EndsAt == nil {
+		return ""
+	}
+	return fmt.Sprintf(" until %s", sanction.EndsAt.UTC().Format(time.RFC3339))
+}
@@ -0,0 +1,33 @@
+// models/appeal.go
+package models
+
+import "time"
+
+// Appeal statuses
+const (
+    AppealPending    = "pending"
+    AppealUpheld     = "upheld"
+    AppealOverturned = "overturned"
+)
+
+// Appeal is an author contesting a moderation decision on their post. It
+// must be reviewed by someone other than the moderator who decided.
+type Appeal struct {
+    ID     uint
+    PostID uint  `gorm:"index"`
+    Post   *Post `json:",omitempty"`
+    UserID uint  `gorm:"index"`
+    // ActionID is the contested moderation action, nil when the post was
+    // flagged by the policy without a moderator
+    ActionID *uint
+    // DecidedBy is the moderator who took the contested action, 0 for the
+    // policy
+    DecidedBy  uint
+    Statement  string
+    Status     string `gorm:"index"`
+    ReviewerID *uint
+    ReviewNote string
+    ReviewedAt *time.Time
+    CreatedAt  time.Time
+    UpdatedAt  time.Time
+}
@@ -0,0 +1,13 @@
+// models/block.go
+package models
+
+import "time"
+
+// Block keeps two users apart: neither sees the other's content, and
+// neither can reply to or mention the other
+type Block struct {
+    ID        uint
+    BlockerID uint `gorm:"uniqueIndex:idx_block_pair"`
+    BlockedID uint `gorm:"uniqueIndex:idx_block_pair;index"`
+    CreatedAt time.Time
+}
@@ -0,0 +1,31 @@
+// models/comment.go
+package models
+
+import (
+    "time"
+
+    "gorm.io/gorm"
+)
+
+// Comment is a reply to a post, or to another comment on the same post
+// when ParentID is set. Comments are screened like posts and go through the
+// same lifecycle states.
+type Comment struct {
+    ID            uint
+    PostID        uint  `gorm:"index"`
+    ParentID      *uint `gorm:"index"`
+    UserID        uint  `gorm:"index"`
+    Content       string
+    ToxicityScore int
+    IsFlagged     bool
+    Severity      string
+    Sentiment     string
+    PolicyAction  string
+    State         string `gorm:"index;default:published"`
+    CreatedAt     time.Time
+    UpdatedAt     time.Time
+    DeletedAt     gorm.DeletedAt `gorm:"index"`
+    DeletedBy     *uint
+    // LegalHold keeps the comment from being purged, like Post.LegalHold
+    LegalHold bool `gorm:"index"`
+}
@@ -0,0 +1,13 @@
+// models/follow.go
+package models
+
+import "time"
+
+// Follow is a user subscribing to another user's posts in their following
+// feed
+type Follow struct {
+    ID         uint
+    FollowerID uint `gorm:"uniqueIndex:idx_follow_pair"`
+    FolloweeID uint `gorm:"uniqueIndex:idx_follow_pair;index"`
+    CreatedAt  time.Time
+}
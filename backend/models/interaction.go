@@ -0,0 +1,28 @@
+// models/interaction.go
+package models
+
+import "time"
+
+// Interaction kinds
+const (
+    InteractionMention = "mention"
+    InteractionReply   = "reply"
+)
+
+// Interaction is one post or comment aimed at another user, by mentioning
+// them or replying to them. Interactions are what harassment patterns are
+// found in. PostID is 0 for comments.
+type Interaction struct {
+    ID        uint
+    ActorID   uint  `gorm:"index:idx_interaction_pair"`
+    TargetID  uint  `gorm:"index:idx_interaction_pair;index"`
+    PostID    uint  `gorm:"index"`
+    CommentID *uint `gorm:"index"`
+    Kind      string
+    // Negative marks negative-sentiment or borderline content
+    Negative      bool
+    ToxicityScore int
+    // Pattern is set when the post was part of a targeted harassment pattern
+    Pattern   bool
+    CreatedAt time.Time `gorm:"index"`
+}
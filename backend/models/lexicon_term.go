@@ -0,0 +1,37 @@
+// models/lexicon_term.go
+package models
+
+import "time"
+
+// Lexicon term kinds
+const (
+    LexiconTermBlock = "block"
+    LexiconTermAllow = "allow"
+)
+
+// LexiconTerm is a community-specific term managed by moderators on top of
+// the built-in lexicons
+type LexiconTerm struct {
+    ID        uint
+    Term      string `gorm:"index"`
+    Kind      string // "block" or "allow"
+    Category  string // canonical category, only used by block terms
+    Weight    float64
+    Severity  string
+    Note      string
+    CreatedBy uint
+    UpdatedBy uint
+    CreatedAt time.Time
+    UpdatedAt time.Time
+}
+
+// LexiconTermAudit records every change made to a LexiconTerm
+type LexiconTermAudit struct {
+    ID        uint
+    TermID    uint `gorm:"index"`
+    ActorID   uint
+    Action    string // "create", "update" or "delete"
+    Before    *LexiconTerm `gorm:"serializer:json"`
+    After     *LexiconTerm `gorm:"serializer:json"`
+    CreatedAt time.Time
+}
@@ -0,0 +1,62 @@
+// models/moderation_action.go
+package models
+
+import (
+    "errors"
+    "time"
+
+    "gorm.io/gorm"
+)
+
+// Moderation action types
+const (
+    ActionApprove  = "approve"
+    ActionMarkSafe = "mark_safe"
+    ActionHold     = "hold"
+    ActionHide     = "hide"
+    ActionReject   = "reject"
+    ActionRemove   = "remove"
+    ActionSkip     = "skip"
+    ActionReassign = "reassign"
+    ActionDelete   = "delete"
+    ActionRestore  = "restore"
+    ActionExport   = "export"
+
+    ActionAppealUpheld     = "appeal_upheld"
+    ActionAppealOverturned = "appeal_overturned"
+    ActionSanction         = "sanction"
+    ActionLiftSanction     = "lift_sanction"
+)
+
+// ErrAppendOnly is returned when a recorded moderation action is changed
+var ErrAppendOnly = errors.New("moderation actions are append-only")
+
+// ModerationAction records one moderator decision, or an author deleting
+// their own post: who did it, on what, why, and what the post looked like
+// at the time. Actions on comments have CommentID set instead of PostID.
+// Rows are never updated or deleted.
+type ModerationAction struct {
+    ID           uint
+    ActorID      uint   `gorm:"index"`
+    Action       string `gorm:"index"`
+    PostID       *uint  `gorm:"index"`
+    CommentID    *uint  `gorm:"index"`
+    TargetUserID *uint  `gorm:"index"`
+    ReasonCode   string `gorm:"index"`
+    Note         string
+    BeforeState  string
+    AfterState   string
+    // ContentSnapshot is the content when the action was taken
+    ContentSnapshot string
+    CreatedAt       time.Time `gorm:"index"`
+}
+
+// BeforeUpdate keeps recorded actions from being changed
+func (a *ModerationAction) BeforeUpdate(tx *gorm.DB) error {
+    return ErrAppendOnly
+}
+
+// BeforeDelete keeps recorded actions from being removed
+func (a *ModerationAction) BeforeDelete(tx *gorm.DB) error {
+    return ErrAppendOnly
+}
@@ -0,0 +1,51 @@
+// models/moderation_queue_item.go
+package models
+
+import "time"
+
+// Moderation queue item statuses
+const (
+    QueueItemOpen     = "open"
+    QueueItemResolved = "resolved"
+)
+
+// ModerationQueueItem is a post or comment waiting for a moderator. A
+// moderator claims an item for a limited lease so nobody else works on it
+// at the same time. Comment items have CommentID set and PostID pointing to
+// the post the comment was written on.
+type ModerationQueueItem struct {
+    ID        uint
+    PostID    uint     `gorm:"index"`
+    Post      *Post    `json:",omitempty"`
+    CommentID *uint    `gorm:"index"`
+    Comment   *Comment `json:",omitempty"`
+    Status    string   `gorm:"index"`
+    // BasePriority comes from severity, author history, harassment
+    // patterns and notifying policy rules; age is added when the queue is
+    // ordered
+    BasePriority       float64
+    Severity           string
+    AuthorHistory      int
+    TargetedHarassment bool
+    // Notify is set when a policy rule asking for moderators to be told
+    // fired on the content while the item was open
+    Notify bool
+    // AssignedTo reserves the item for one moderator
+    AssignedTo     *uint `gorm:"index"`
+    ClaimedBy      *uint `gorm:"index"`
+    ClaimExpiresAt *time.Time
+    Resolution     string
+    ResolvedBy     *uint
+    ResolvedAt     *time.Time
+    CreatedAt      time.Time
+    UpdatedAt      time.Time
+}
+
+// QueueSkip records that a moderator passed on an item, so it is not
+// handed to them again
+type QueueSkip struct {
+    ID          uint
+    ItemID      uint `gorm:"index"`
+    ModeratorID uint `gorm:"index"`
+    CreatedAt   time.Time
+}
@@ -0,0 +1,13 @@
+// models/mute.go
+package models
+
+import "time"
+
+// Mute silently hides a user's content from the user who muted them. The
+// muted user is not told and sees nothing different.
+type Mute struct {
+    ID        uint
+    MuterID   uint `gorm:"uniqueIndex:idx_mute_pair"`
+    MutedID   uint `gorm:"uniqueIndex:idx_mute_pair;index"`
+    CreatedAt time.Time
+}
@@ -0,0 +1,19 @@
+// models/policy_version.go
+package models
+
+import (
+    "time"
+
+    "github.com/elham-abdu/cyberbullyprevention/policy"
+)
+
+// PolicyVersion is one saved version of the moderation policy. Versions are
+// never changed; the newest one is active.
+type PolicyVersion struct {
+    ID        uint
+    Version   int           `gorm:"uniqueIndex"`
+    Rules     []policy.Rule `gorm:"serializer:json"`
+    Note      string
+    CreatedBy uint
+    CreatedAt time.Time
+}
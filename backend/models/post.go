@@ -1,14 +1,70 @@
 // models/post.go
 package models
 
-import "time"
+import (
+    "time"
+
+    "gorm.io/gorm"
+)
+
+// Post lifecycle states
+const (
+    PostPendingReview = "pending_review"
+    PostPublished     = "published"
+    PostHidden        = "hidden"
+    PostRejected      = "rejected"
+    PostRemoved       = "removed"
+)
+
+// postTransitions lists the states a post may move to from each state
+var postTransitions = map[string][]string{
+    PostPendingReview: {PostPublished, PostHidden, PostRejected, PostRemoved},
+    PostPublished:     {PostPendingReview, PostHidden, PostRemoved},
+    PostHidden:        {PostPublished, PostPendingReview, PostRemoved},
+    PostRejected:      {PostPublished, PostRemoved},
+    PostRemoved:       {PostPublished},
+}
+
+// IsPostState reports whether state is a known lifecycle state
+func IsPostState(state string) bool {
+    _, ok := postTransitions[state]
+    return ok
+}
+
+// CanTransition reports whether a post may move from one state to another
+func CanTransition(from, to string) bool {
+    for _, state := range postTransitions[from] {
+        if state == to {
+            return true
+        }
+    }
+    return false
+}
 
 type Post struct {
     ID            uint
     UserID        uint
     Content       string
+    // ReplyToID is the post this one answers, if any
+    ReplyToID     *uint `gorm:"index"`
     ToxicityScore int
     IsFlagged     bool
+    Severity      string
+    Sentiment     string
+    // PolicyAction is what the moderation policy decided for the content
+    PolicyAction  string
+    // State is the lifecycle state, only published posts are public
+    State         string `gorm:"index;default:published"`
     CreatedAt     time.Time
     UpdatedAt     time.Time
+    // DeletedAt soft-deletes the post: it disappears for users but is kept
+    // for admins until the retention period runs out
+    DeletedAt gorm.DeletedAt `gorm:"index"`
+    DeletedBy *uint
+    // LegalHold keeps the post from ever being purged once it is part of an
+    // exported evidence case
+    LegalHold bool `gorm:"index"`
+
+    // Analyses is only loaded when requested, newest first
+    Analyses []PostAnalysis `json:",omitempty"`
 }
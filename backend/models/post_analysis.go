@@ -0,0 +1,27 @@
+// models/post_analysis.go
+package models
+
+import (
+    "encoding/json"
+    "time"
+)
+
+// PostAnalysis keeps every toxicity analysis run on a post, so re-analyses
+// don't overwrite earlier results. Analyses of a comment have CommentID set
+// and PostID pointing at the comment's post.
+type PostAnalysis struct {
+    ID              uint
+    PostID          uint  `gorm:"index"`
+    CommentID       *uint `gorm:"index"`
+    Provider        string
+    ProviderVersion string
+    LatencyMs       int64
+    Score           float64
+    IsFlagged       bool
+    Severity        string
+    Sentiment       string
+    Confidence      float64
+    // Result is the full pipeline result as JSON
+    Result    json.RawMessage `gorm:"serializer:json;type:text"`
+    CreatedAt time.Time
+}
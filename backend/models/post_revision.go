@@ -0,0 +1,16 @@
+// models/post_revision.go
+package models
+
+import "time"
+
+// PostRevision records one version of a post's content, together with
+// who wrote it and the analysis of that version
+type PostRevision struct {
+    ID         uint
+    PostID     uint `gorm:"index"`
+    EditorID   uint
+    Content    string
+    AnalysisID *uint
+    Analysis   *PostAnalysis `json:",omitempty"`
+    CreatedAt  time.Time
+}
@@ -0,0 +1,53 @@
+// models/strike.go
+package models
+
+import "time"
+
+// Sanction kinds, from mildest to most severe
+const (
+    SanctionWarning    = "warning"
+    SanctionCooldown   = "cooldown"
+    SanctionSuspension = "suspension"
+    SanctionBan        = "ban"
+)
+
+// Strike is one confirmed violation counted against a user, in a post or
+// a comment. Its weight decays over time; revoked strikes, e.g. after an
+// overturned appeal, no longer count.
+type Strike struct {
+    ID         uint
+    UserID     uint  `gorm:"index"`
+    PostID     *uint `gorm:"index"`
+    CommentID  *uint `gorm:"index"`
+    ActionID   *uint
+    ReasonCode string
+    Weight     float64
+    IssuedBy   uint
+    RevokedAt  *time.Time
+    RevokedBy  *uint
+    CreatedAt  time.Time
+}
+
+// Sanction is a restriction applied to a user when their strikes cross a
+// threshold. EndsAt is nil for permanent sanctions.
+type Sanction struct {
+    ID     uint
+    UserID uint   `gorm:"index"`
+    Kind   string `gorm:"index"`
+    // Points is the decayed strike total that triggered the sanction
+    Points    float64
+    StrikeID  *uint
+    StartsAt  time.Time
+    EndsAt    *time.Time
+    LiftedAt  *time.Time
+    LiftedBy  *uint
+    CreatedAt time.Time
+}
+
+// ActiveAt reports whether the sanction applies at t
+func (s *Sanction) ActiveAt(t time.Time) bool {
+    if s.LiftedAt != nil || t.Before(s.StartsAt) {
+        return false
+    }
+    return s.EndsAt == nil || t.Before(*s.EndsAt)
+}
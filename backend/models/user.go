@@ -6,6 +6,7 @@ import "time"
 type User struct {
     ID           uint
     Email        string
+    Username     *string `gorm:"uniqueIndex"`
     PasswordHash string
     Role         string
     CreatedAt    time.Time
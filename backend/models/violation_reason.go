@@ -0,0 +1,20 @@
+// models/violation_reason.go
+package models
+
+import "time"
+
+// ViolationReason is one entry of the taxonomy moderators pick from when
+// they take content down. Codes never change once created, so recorded
+// actions keep pointing at the right reason; retired reasons are marked
+// inactive instead of deleted.
+type ViolationReason struct {
+    ID          uint
+    Code        string `gorm:"uniqueIndex"`
+    Label       string
+    Description string
+    // StrikeWeight is how many strikes a violation adds, 1 when unset
+    StrikeWeight float64
+    Active       bool
+    CreatedAt    time.Time
+    UpdatedAt    time.Time
+}
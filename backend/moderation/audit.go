@@ -0,0 +1,116 @@
+package moderation
+
+import (
+    "time"
+
+    "github.com/elham-abdu/cyberbullyprevention/models"
+    "gorm.io/gorm"
+)
+
+// appendOnlySQL installs a trigger that rejects any UPDATE or DELETE on the
+// audit log, so rows stay untouched even outside the application
+var appendOnlySQL = []string{
+    `CREATE OR REPLACE FUNCTION moderation_actions_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'moderation_actions is append-only';
+END;
+$$ LANGUAGE plpgsql`,
+    `DROP TRIGGER IF EXISTS moderation_actions_append_only ON moderation_actions`,
+    `CREATE TRIGGER moderation_actions_append_only
+    BEFORE UPDATE OR DELETE ON moderation_actions
+    FOR EACH ROW EXECUTE FUNCTION moderation_actions_append_only()`,
+}
+
+// EnsureAppendOnly protects the audit log table at the database level
+func EnsureAppendOnly(db *gorm.DB) error {
+    for _, statement := range appendOnlySQL {
+        if err := db.Exec(statement).Error; err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Record appends a moderation action for a post to the audit log. The
+// post's author and current content are captured with it.
+func Record(tx *gorm.DB, post *models.Post, action models.ModerationAction) (*models.ModerationAction, error) {
+    if post != nil {
+        action.PostID = &post.ID
+        action.TargetUserID = &post.UserID
+        action.ContentSnapshot = post.Content
+        if action.BeforeState == "" {
+            action.BeforeState = post.State
+        }
+        if action.AfterState == "" {
+            action.AfterState = post.State
+        }
+    }
+    if err := tx.Create(&action).Error; err != nil {
+        return nil, err
+    }
+    return &action, nil
+}
+
+// RecordComment appends a moderation action for a comment to the audit
+// log, capturing its author and current content like Record
+func RecordComment(tx *gorm.DB, comment *models.Comment, action models.ModerationAction) (*models.ModerationAction, error) {
+    action.CommentID = &comment.ID
+    action.TargetUserID = &comment.UserID
+    action.ContentSnapshot = comment.Content
+    if action.BeforeState == "" {
+        action.BeforeState = comment.State
+    }
+    if action.AfterState == "" {
+        action.AfterState = comment.State
+    }
+    if err := tx.Create(&action).Error; err != nil {
+        return nil, err
+    }
+    return &action, nil
+}
+
+// AuditFilter narrows the audit log. Zero values match everything; To is
+// exclusive.
+type AuditFilter struct {
+    ActorID      uint
+    Action       string
+    PostID       uint
+    CommentID    uint
+    TargetUserID uint
+    From         time.Time
+    To           time.Time
+    Limit        int
+}
+
+// Audit returns the recorded actions matching filter, newest first
+func Audit(db *gorm.DB, filter AuditFilter) ([]models.ModerationAction, error) {
+    query := db.Model(&models.ModerationAction{})
+    if filter.ActorID != 0 {
+        query = query.Where("actor_id = ?", filter.ActorID)
+    }
+    if filter.Action != "" {
+        query = query.Where("action = ?", filter.Action)
+    }
+    if filter.PostID != 0 {
+        query = query.Where("post_id = ?", filter.PostID)
+    }
+    if filter.CommentID != 0 {
+        query = query.Where("comment_id = ?", filter.CommentID)
+    }
+    if filter.TargetUserID != 0 {
+        query = query.Where("target_user_id = ?", filter.TargetUserID)
+    }
+    if !filter.From.IsZero() {
+        query = query.Where("created_at >= ?", filter.From)
+    }
+    if !filter.To.IsZero() {
+        query = query.Where("created_at < ?", filter.To)
+    }
+    if filter.Limit > 0 {
+        query = query.Limit(filter.Limit)
+    }
+
+    var actions []models.ModerationAction
+    err := query.Order("created_at DESC, id DESC").Find(&actions).Error
+    return actions, err
+}
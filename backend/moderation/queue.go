@@ -0,0 +1,467 @@
+// Package moderation keeps the queue of posts and comments waiting for a
+// moderator and the audit log of moderator decisions.
+//
+// Items are ordered by priority: a base priority from the post severity,
+// the author's history, whether the post is part of a targeted harassment
+// pattern and whether a notifying policy rule fired on it, plus a bonus
+// that grows with the item's age so old items are not starved. A moderator
+// claims an item for a lease; while the lease runs nobody else is handed
+// the item or can act on its post. Claims use SELECT ... FOR UPDATE SKIP
+// LOCKED, so concurrent moderators asking for their next item never get the
+// same one.
+package moderation
+
+import (
+    "errors"
+    "fmt"
+    "strconv"
+    "time"
+
+    "github.com/elham-abdu/cyberbullyprevention/config"
+    "github.com/elham-abdu/cyberbullyprevention/models"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+)
+
+var (
+    // ErrClaimed is returned when another moderator holds the item
+    ErrClaimed = errors.New("item is claimed by another moderator")
+    // ErrNotClaimed is returned when the moderator does not hold the item
+    ErrNotClaimed = errors.New("item is not claimed by this moderator")
+    // ErrResolved is returned for items that are no longer open
+    ErrResolved = errors.New("item is already resolved")
+    // ErrNotModerator is returned when an item is reassigned to a user who
+    // is not an admin or moderator, or does not exist
+    ErrNotModerator = errors.New("moderator not found")
+)
+
+// moderatorRoles are the user roles that can work the queue
+var moderatorRoles = map[string]bool{"admin": true, "moderator": true}
+
+// severityPriority is the base priority of each severity
+var severityPriority = map[string]float64{
+    "none":     0,
+    "low":      10,
+    "medium":   20,
+    "high":     40,
+    "critical": 80,
+}
+
+const (
+    // historyPriority is added per earlier flagged post or comment of the
+    // author
+    historyPriority = 5
+    // maxHistoryPriority caps the author history bonus
+    maxHistoryPriority = 30
+    // heldPriority is added for posts kept out of publication
+    heldPriority = 20
+    // harassmentPriority is added for posts in a targeted harassment pattern
+    harassmentPriority = 30
+    // notifyPriority is added for posts a notifying policy rule fired on
+    notifyPriority = 40
+    // agePriorityPerHour is added for every hour an item waits
+    agePriorityPerHour = 2
+)
+
+// priorityOrder sorts open items by their current priority, oldest first
+// on ties
+var priorityOrder = clause.OrderBy{Expression: clause.Expr{
+    SQL:                "base_priority + EXTRACT(EPOCH FROM (NOW() - created_at)) / 3600 * ? DESC, created_at ASC",
+    Vars:               []interface{}{agePriorityPerHour},
+    WithoutParentheses: true,
+}}
+
+// LeaseDuration is how long a claim lasts, from MODERATION_LEASE_MINUTES
+// (default 10)
+func LeaseDuration() time.Duration {
+    minutes, err := strconv.Atoi(config.GetEnvOrDefault("MODERATION_LEASE_MINUTES", "10"))
+    if err != nil || minutes <= 0 {
+        minutes = 10
+    }
+    return time.Duration(minutes) * time.Minute
+}
+
+// Enqueue adds a post to the queue, or refreshes the priority of its open
+// item when it is already queued. notify marks the item for a notifying
+// policy rule; the mark stays until the item is resolved.
+func Enqueue(tx *gorm.DB, post *models.Post, notify bool) (*models.ModerationQueueItem, error) {
+    history, err := authorHistory(tx, post.UserID, post.ID, 0)
+    if err != nil {
+        return nil, err
+    }
+    var patterns int64
+    err = tx.Model(&models.Interaction{}).Where("post_id = ? AND pattern", post.ID).Count(&patterns).Error
+    if err != nil {
+        return nil, err
+    }
+
+    var item models.ModerationQueueItem
+    openItem(tx, postItem, post.ID, &item)
+    item.PostID = post.ID
+    item.Notify = item.Notify || notify
+    return saveItem(tx, &item, post.Severity, post.State, history, patterns > 0)
+}
+
+// EnqueueComment adds a comment to the queue like Enqueue does for posts
+func EnqueueComment(tx *gorm.DB, comment *models.Comment, notify bool) (*models.ModerationQueueItem, error) {
+    history, err := authorHistory(tx, comment.UserID, 0, comment.ID)
+    if err != nil {
+        return nil, err
+    }
+    var patterns int64
+    err = tx.Model(&models.Interaction{}).Where("comment_id = ? AND pattern", comment.ID).Count(&patterns).Error
+    if err != nil {
+        return nil, err
+    }
+
+    var item models.ModerationQueueItem
+    openItem(tx, commentItem, comment.ID, &item)
+    item.PostID = comment.PostID
+    item.CommentID = &comment.ID
+    item.Notify = item.Notify || notify
+    return saveItem(tx, &item, comment.Severity, comment.State, history, patterns > 0)
+}
+
+// authorHistory counts the earlier flagged, rejected or removed posts and
+// comments of a user, leaving out the post or comment being queued. Content
+// the author deleted still counts.
+func authorHistory(tx *gorm.DB, userID, postID, commentID uint) (int64, error) {
+    var posts, comments int64
+    err := tx.Unscoped().Model(&models.Post{}).
+        Where("user_id = ? AND id <> ?", userID, postID).
+        Where("is_flagged = ? OR state IN ?", true, []string{models.PostRejected, models.PostRemoved}).
+        Count(&posts).Error
+    if err != nil {
+        return 0, err
+    }
+    err = tx.Unscoped().Model(&models.Comment{}).
+        Where("user_id = ? AND id <> ?", userID, commentID).
+        Where("is_flagged = ? OR state IN ?", true, []string{models.PostRejected, models.PostRemoved}).
+        Count(&comments).Error
+    return posts + comments, err
+}
+
+// saveItem sets the priority of an item and opens it
+func saveItem(tx *gorm.DB, item *models.ModerationQueueItem, severity, state string, history int64, pattern bool) (*models.ModerationQueueItem, error) {
+    priority := severityPriority[severity]
+    priority += min(float64(history)*historyPriority, maxHistoryPriority)
+    if state == models.PostPendingReview {
+        priority += heldPriority
+    }
+    if pattern {
+        priority += harassmentPriority
+    }
+    if item.Notify {
+        priority += notifyPriority
+    }
+
+    item.Status = models.QueueItemOpen
+    item.BasePriority = priority
+    item.Severity = severity
+    item.AuthorHistory = int(history)
+    item.TargetedHarassment = pattern
+    if err := tx.Save(item).Error; err != nil {
+        return nil, err
+    }
+    return item, nil
+}
+
+// postItem and commentItem select the items of a post and of a comment.
+// Comment items also carry the post the comment was written on, so a post's
+// own items are those without a comment.
+const (
+    postItem    = "post_id = ? AND comment_id IS NULL"
+    commentItem = "comment_id = ?"
+)
+
+// openItem loads the open item that subject, postItem or commentItem,
+// selects for id. It reports false when there is none.
+func openItem(tx *gorm.DB, subject string, id uint, item *models.ModerationQueueItem) bool {
+    return tx.Where(subject, id).Where("status = ?", models.QueueItemOpen).Limit(1).Find(item).RowsAffected > 0
+}
+
+// Resolve closes the open item of a post. The moderator must hold the claim
+// if someone holds one; actorID 0 closes it on behalf of the system, e.g.
+// when the author edits the problem away.
+func Resolve(tx *gorm.DB, postID, actorID uint, resolution string) error {
+    return resolve(tx, postItem, postID, actorID, resolution)
+}
+
+// ResolveComment closes the open item of a comment like Resolve
+func ResolveComment(tx *gorm.DB, commentID, actorID uint, resolution string) error {
+    return resolve(tx, commentItem, commentID, actorID, resolution)
+}
+
+// resolve closes the open item subject selects for id
+func resolve(tx *gorm.DB, subject string, id, actorID uint, resolution string) error {
+    var item models.ModerationQueueItem
+    if !openItem(tx, subject, id, &item) {
+        return nil
+    }
+    if actorID != 0 && heldByOther(&item, actorID, time.Now()) {
+        return ErrClaimed
+    }
+
+    now := time.Now()
+    item.Status = models.QueueItemResolved
+    item.Resolution = resolution
+    item.ClaimedBy = nil
+    item.ClaimExpiresAt = nil
+    if actorID != 0 {
+        item.ResolvedBy = &actorID
+    }
+    item.ResolvedAt = &now
+    return tx.Save(&item).Error
+}
+
+// CheckClaim returns ErrClaimed when another moderator holds the open item
+// of a post
+func CheckClaim(tx *gorm.DB, postID, moderatorID uint) error {
+    return checkClaim(tx, postItem, postID, moderatorID)
+}
+
+// CheckCommentClaim returns ErrClaimed when another moderator holds the
+// open item of a comment
+func CheckCommentClaim(tx *gorm.DB, commentID, moderatorID uint) error {
+    return checkClaim(tx, commentItem, commentID, moderatorID)
+}
+
+// checkClaim checks the open item subject selects for id
+func checkClaim(tx *gorm.DB, subject string, id, moderatorID uint) error {
+    var item models.ModerationQueueItem
+    if openItem(tx, subject, id, &item) && heldByOther(&item, moderatorID, time.Now()) {
+        return ErrClaimed
+    }
+    return nil
+}
+
+// Next claims the highest priority item the moderator may work on. A
+// moderator already holding an item gets it back with a renewed lease.
+// It returns nil when the queue is empty.
+func Next(db *gorm.DB, moderatorID uint, lease time.Duration) (*models.ModerationQueueItem, error) {
+    var claimed *models.ModerationQueueItem
+    err := db.Transaction(func(tx *gorm.DB) error {
+        now := time.Now()
+
+        var item models.ModerationQueueItem
+        found := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+            Where("status = ? AND claimed_by = ? AND claim_expires_at > ?", models.QueueItemOpen, moderatorID, now).
+            Limit(1).Find(&item).RowsAffected > 0
+
+        if !found {
+            skipped := tx.Model(&models.QueueSkip{}).Select("item_id").Where("moderator_id = ?", moderatorID)
+            result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+                Where("status = ?", models.QueueItemOpen).
+                Where("claimed_by IS NULL OR claim_expires_at <= ?", now).
+                Where("assigned_to IS NULL OR assigned_to = ?", moderatorID).
+                Where("id NOT IN (?)", skipped).
+                Order(priorityOrder).
+                Limit(1).Find(&item)
+            if result.Error != nil {
+                return result.Error
+            }
+            if result.RowsAffected == 0 {
+                return nil
+            }
+        }
+
+        claim(&item, moderatorID, now, lease)
+        if err := tx.Save(&item).Error; err != nil {
+            return err
+        }
+        claimed = &item
+        return nil
+    })
+    return claimed, err
+}
+
+// Claim locks a specific item for the moderator, or renews their lease
+func Claim(db *gorm.DB, itemID, moderatorID uint, lease time.Duration) (*models.ModerationQueueItem, error) {
+    var item models.ModerationQueueItem
+    err := db.Transaction(func(tx *gorm.DB) error {
+        if err := lockItem(tx, itemID, &item); err != nil {
+            return err
+        }
+        now := time.Now()
+        if heldByOther(&item, moderatorID, now) {
+            return ErrClaimed
+        }
+        claim(&item, moderatorID, now, lease)
+        return tx.Save(&item).Error
+    })
+    if err != nil {
+        return nil, err
+    }
+    return &item, nil
+}
+
+// Release gives up the moderator's claim on an item
+func Release(db *gorm.DB, itemID, moderatorID uint) (*models.ModerationQueueItem, error) {
+    var item models.ModerationQueueItem
+    err := db.Transaction(func(tx *gorm.DB) error {
+        if err := lockItem(tx, itemID, &item); err != nil {
+            return err
+        }
+        if !heldBy(&item, moderatorID, time.Now()) {
+            return ErrNotClaimed
+        }
+        item.ClaimedBy = nil
+        item.ClaimExpiresAt = nil
+        return tx.Save(&item).Error
+    })
+    if err != nil {
+        return nil, err
+    }
+    return &item, nil
+}
+
+// Skip releases an item and keeps it from being handed to the moderator
+// again
+func Skip(db *gorm.DB, itemID, moderatorID uint) (*models.ModerationQueueItem, error) {
+    var item models.ModerationQueueItem
+    err := db.Transaction(func(tx *gorm.DB) error {
+        if err := lockItem(tx, itemID, &item); err != nil {
+            return err
+        }
+        if heldByOther(&item, moderatorID, time.Now()) {
+            return ErrClaimed
+        }
+        if heldBy(&item, moderatorID, time.Now()) {
+            item.ClaimedBy = nil
+            item.ClaimExpiresAt = nil
+        }
+        // A skipped assignment goes back to everyone
+        if item.AssignedTo != nil && *item.AssignedTo == moderatorID {
+            item.AssignedTo = nil
+        }
+        if err := tx.Save(&item).Error; err != nil {
+            return err
+        }
+        if err := tx.Create(&models.QueueSkip{ItemID: item.ID, ModeratorID: moderatorID}).Error; err != nil {
+            return err
+        }
+        return recordItem(tx, &item, moderatorID, models.ActionSkip, "")
+    })
+    if err != nil {
+        return nil, err
+    }
+    return &item, nil
+}
+
+// Reassign reserves an item for another moderator and hands them the
+// claim on behalf of actorID. Any current claim is dropped. The new
+// moderator must be an admin or moderator, else ErrNotModerator.
+func Reassign(db *gorm.DB, itemID, actorID, moderatorID uint, lease time.Duration) (*models.ModerationQueueItem, error) {
+    var item models.ModerationQueueItem
+    err := db.Transaction(func(tx *gorm.DB) error {
+        var moderator models.User
+        err := tx.First(&moderator, moderatorID).Error
+        if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !moderatorRoles[moderator.Role]) {
+            return ErrNotModerator
+        }
+        if err != nil {
+            return err
+        }
+        if err := lockItem(tx, itemID, &item); err != nil {
+            return err
+        }
+        item.AssignedTo = &moderatorID
+        claim(&item, moderatorID, time.Now(), lease)
+        // The new moderator may have skipped it before
+        if err := tx.Where("item_id = ? AND moderator_id = ?", item.ID, moderatorID).Delete(&models.QueueSkip{}).Error; err != nil {
+            return err
+        }
+        if err := tx.Save(&item).Error; err != nil {
+            return err
+        }
+        return recordItem(tx, &item, actorID, models.ActionReassign, fmt.Sprintf("assigned to moderator %d", moderatorID))
+    })
+    if err != nil {
+        return nil, err
+    }
+    return &item, nil
+}
+
+// List returns the open items in priority order. Posts and comments deleted
+// while in the queue are still loaded so they can be reviewed.
+func List(db *gorm.DB, limit int) ([]models.ModerationQueueItem, error) {
+    var items []models.ModerationQueueItem
+    unscoped := func(tx *gorm.DB) *gorm.DB { return tx.Unscoped() }
+    err := db.Preload("Post", unscoped).
+        Preload("Comment", unscoped).
+        Where("status = ?", models.QueueItemOpen).
+        Order(priorityOrder).
+        Limit(limit).
+        Find(&items).Error
+    return items, err
+}
+
+// Backfill queues flagged posts that are still under review but have no
+// open item, e.g. posts flagged before the queue existed
+func Backfill(db *gorm.DB) (int, error) {
+    var posts []models.Post
+    open := db.Model(&models.ModerationQueueItem{}).Select("post_id").Where("status = ? AND comment_id IS NULL", models.QueueItemOpen)
+    err := db.Where("is_flagged = ? AND state NOT IN ?", true, []string{models.PostRejected, models.PostRemoved}).
+        Where("id NOT IN (?)", open).
+        Find(&posts).Error
+    if err != nil {
+        return 0, err
+    }
+
+    for i := range posts {
+        if _, err := Enqueue(db, &posts[i], false); err != nil {
+            return i, err
+        }
+    }
+    return len(posts), nil
+}
+
+// lockItem loads an open item for update
+func lockItem(tx *gorm.DB, itemID uint, item *models.ModerationQueueItem) error {
+    if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(item, itemID).Error; err != nil {
+        return err
+    }
+    if item.Status != models.QueueItemOpen {
+        return ErrResolved
+    }
+    return nil
+}
+
+// recordItem writes a queue action on an item's post or comment to the
+// audit log
+func recordItem(tx *gorm.DB, item *models.ModerationQueueItem, actorID uint, action, note string) error {
+    if item.CommentID != nil {
+        var comment models.Comment
+        if err := tx.Unscoped().First(&comment, *item.CommentID).Error; err != nil {
+            return err
+        }
+        _, err := RecordComment(tx, &comment, models.ModerationAction{ActorID: actorID, Action: action, Note: note})
+        return err
+    }
+
+    var post models.Post
+    if err := tx.Unscoped().First(&post, item.PostID).Error; err != nil {
+        return err
+    }
+    _, err := Record(tx, &post, models.ModerationAction{ActorID: actorID, Action: action, Note: note})
+    return err
+}
+
+// claim gives the item to a moderator until the lease runs out
+func claim(item *models.ModerationQueueItem, moderatorID uint, now time.Time, lease time.Duration) {
+    expires := now.Add(lease)
+    item.ClaimedBy = &moderatorID
+    item.ClaimExpiresAt = &expires
+}
+
+// heldBy reports whether moderatorID holds an unexpired claim on the item
+func heldBy(item *models.ModerationQueueItem, moderatorID uint, now time.Time) bool {
+    return item.ClaimedBy != nil && *item.ClaimedBy == moderatorID &&
+        item.ClaimExpiresAt != nil && item.ClaimExpiresAt.After(now)
+}
+
+// heldByOther reports whether someone else holds an unexpired claim
+func heldByOther(item *models.ModerationQueueItem, moderatorID uint, now time.Time) bool {
+    return item.ClaimedBy != nil && *item.ClaimedBy != moderatorID &&
+        item.ClaimExpiresAt != nil && item.ClaimExpiresAt.After(now)
+}
@@ -0,0 +1,335 @@
+// Package normalize undoes the common tricks used to slip insults past
+// word filters: leetspeak, look-alike Unicode letters, punctuation or spaces
+// between letters, stretched letters, diacritics and invisible characters.
+//
+// Every character of the normalized text remembers which part of the
+// original text it came from, so matches found in the normalized text can
+// be reported against what the user actually wrote.
+package normalize
+
+import (
+    "strings"
+    "unicode"
+    "unicode/utf8"
+
+    "golang.org/x/text/unicode/norm"
+)
+
+// Span is a byte range [Start, End) in the original text
+type Span struct {
+    Start int `json:"start"`
+    End   int `json:"end"`
+}
+
+// Result is the normalized text together with its offset map
+type Result struct {
+    Original string
+    Text     string
+    // Map has one entry per byte of Text with the original bytes it came from
+    Map []Span
+}
+
+// OriginalRange maps a byte range of the normalized text back to a byte
+// range of the original text
+func (r Result) OriginalRange(start, end int) (int, int) {
+    if start < 0 {
+        start = 0
+    }
+    if end > len(r.Map) {
+        end = len(r.Map)
+    }
+    if start >= end {
+        if start < len(r.Map) {
+            return r.Map[start].Start, r.Map[start].Start
+        }
+        return len(r.Original), len(r.Original)
+    }
+    return r.Map[start].Start, r.Map[end-1].End
+}
+
+// Changed reports whether normalization altered the text
+func (r Result) Changed() bool {
+    return r.Text != r.Original
+}
+
+// char is a normalized rune and the original bytes it stands for
+type char struct {
+    r    rune
+    span Span
+}
+
+// Normalize runs every normalization step over text
+func Normalize(text string) Result {
+    chars := decode(text)
+    chars = foldRunes(chars)
+    chars = replaceLeet(chars)
+    chars = joinSeparatedLetters(chars)
+    chars = collapseRepeats(chars)
+    chars = collapseSpaces(chars)
+    return encode(text, chars)
+}
+
+// decode splits text into runes with their original byte ranges
+func decode(text string) []char {
+    chars := make([]char, 0, len(text))
+    for i, r := range text {
+        chars = append(chars, char{r: r, span: Span{Start: i, End: i + utf8.RuneLen(r)}})
+    }
+    return chars
+}
+
+// encode builds the Result from normalized runes
+func encode(original string, chars []char) Result {
+    var b strings.Builder
+    offsets := make([]Span, 0, len(original))
+    for _, c := range chars {
+        b.WriteRune(c.r)
+        for i := 0; i < utf8.RuneLen(c.r); i++ {
+            offsets = append(offsets, c.span)
+        }
+    }
+    return Result{Original: original, Text: b.String(), Map: offsets}
+}
+
+// foldRunes drops invisible characters, maps confusable letters to ASCII and
+// strips diacritics
+func foldRunes(chars []char) []char {
+    out := make([]char, 0, len(chars))
+    for _, c := range chars {
+        if isInvisible(c.r) {
+            continue
+        }
+        if unicode.IsSpace(c.r) {
+            out = append(out, char{r: ' ', span: c.span})
+            continue
+        }
+        if r, ok := confusables[c.r]; ok {
+            out = append(out, char{r: r, span: c.span})
+            continue
+        }
+        // Fullwidth ASCII, e.g. "ｓｔｕｐｉｄ"
+        if c.r >= 0xFF01 && c.r <= 0xFF5E {
+            out = append(out, char{r: c.r - 0xFEE0, span: c.span})
+            continue
+        }
+        if expansion, ok := ligatures[c.r]; ok {
+            for _, r := range expansion {
+                out = append(out, char{r: r, span: c.span})
+            }
+            continue
+        }
+        if c.r < utf8.RuneSelf {
+            out = append(out, c)
+            continue
+        }
+        for _, r := range norm.NFD.String(string(c.r)) {
+            if !unicode.Is(unicode.Mn, r) {
+                out = append(out, char{r: r, span: c.span})
+            }
+        }
+    }
+    return out
+}
+
+// isInvisible reports zero-width and other formatting characters such as
+// U+200B ZERO WIDTH SPACE, U+00AD SOFT HYPHEN and U+FEFF
+func isInvisible(r rune) bool {
+    return unicode.Is(unicode.Cf, r)
+}
+
+// confusables maps Cyrillic and Greek look-alikes to Latin letters
+var confusables = map[rune]rune{
+    // Cyrillic
+    'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h',
+    'о': 'o', 'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's',
+    'і': 'i', 'ї': 'i', 'ј': 'j', 'ԁ': 'd', 'һ': 'h', 'ӏ': 'l', 'ԛ': 'q',
+    'ԝ': 'w', 'ь': 'b', 'п': 'n', 'г': 'r',
+    'А': 'A', 'В': 'B', 'Е': 'E', 'Ё': 'E', 'К': 'K', 'М': 'M', 'Н': 'H',
+    'О': 'O', 'Р': 'P', 'С': 'C', 'Т': 'T', 'У': 'Y', 'Х': 'X', 'Ѕ': 'S',
+    'І': 'I', 'Ї': 'I', 'Ј': 'J', 'Ԁ': 'D', 'Һ': 'H', 'Ӏ': 'l',
+    // Greek
+    'α': 'a', 'β': 'b', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o',
+    'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w',
+    'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I', 'Κ': 'K',
+    'Μ': 'M', 'Ν': 'N', 'Ο': 'O', 'Ρ': 'P', 'Τ': 'T', 'Υ': 'Y', 'Χ': 'X',
+}
+
+// ligatures expands letters that have no decomposition
+var ligatures = map[rune]string{
+    'ß': "ss", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE",
+    'ø': "o", 'Ø': "O", 'ł': "l", 'Ł': "L", 'đ': "d", 'Đ': "D",
+    'ﬀ': "ff", 'ﬁ': "fi", 'ﬂ': "fl",
+}
+
+// leetDigits are digits that stand in for letters inside words
+var leetDigits = map[rune]rune{
+    '0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b', '9': 'g',
+}
+
+// leetSymbols are symbols that stand in for letters inside words
+var leetSymbols = map[rune]rune{
+    '@': 'a', '$': 's', '!': 'i', '|': 'l', '+': 't',
+}
+
+// replaceLeet maps leetspeak digits and symbols to letters, but only inside
+// words that also contain real letters, so "4 apples" and "100%" are kept
+func replaceLeet(chars []char) []char {
+    out := make([]char, len(chars))
+    copy(out, chars)
+
+    for start := 0; start < len(out); {
+        if out[start].r == ' ' {
+            start++
+            continue
+        }
+        end := start
+        hasLetter := false
+        for end < len(out) && out[end].r != ' ' {
+            if unicode.IsLetter(out[end].r) {
+                hasLetter = true
+            }
+            end++
+        }
+        if hasLetter {
+            leetWord(out[start:end])
+        }
+        start = end
+    }
+    return out
+}
+
+// leetWord rewrites a single word in place
+func leetWord(word []char) {
+    for i := range word {
+        if r, ok := leetDigits[word[i].r]; ok {
+            word[i].r = r
+        }
+    }
+
+    for i := range word {
+        r, ok := leetSymbols[word[i].r]
+        if !ok {
+            continue
+        }
+        // A leading "@" is a mention, not a letter
+        if i == 0 && word[i].r == '@' {
+            continue
+        }
+
+        // Look past repeats of the same symbol, e.g. "a$$hole"
+        next := i + 1
+        for next < len(word) && word[next].r == word[i].r {
+            next++
+        }
+        followedByLetter := next < len(word) && unicode.IsLetter(word[next].r)
+
+        // Trailing "$$" after letters, e.g. "a$$"
+        trailingDollar := word[i].r == '$' && next == len(word) && i > 0 &&
+            (unicode.IsLetter(word[i-1].r) || word[i-1].r == 's')
+
+        if followedByLetter || trailingDollar {
+            word[i].r = r
+        }
+    }
+}
+
+// separators may be inserted between the letters of a word
+func isSeparator(r rune) bool {
+    switch r {
+    case '.', '-', '_', '~', '\'', ',', '/', '\\':
+        return true
+    }
+    return false
+}
+
+// joinSeparatedLetters removes punctuation inserted between letters
+// ("s.t.u.p.i.d", "stu-pid") and joins runs of three or more single letters
+// separated by spaces ("s t u p i d")
+func joinSeparatedLetters(chars []char) []char {
+    out := make([]char, 0, len(chars))
+    for i, c := range chars {
+        if isSeparator(c.r) && letterAt(chars, i-1) && letterAt(chars, i+1) {
+            continue
+        }
+        out = append(out, c)
+    }
+
+    // Runs of single letters separated by single spaces
+    result := make([]char, 0, len(out))
+    for i := 0; i < len(out); {
+        runEnd := singleLetterRun(out, i)
+        if runEnd > i {
+            for j := i; j < runEnd; j++ {
+                if out[j].r != ' ' {
+                    result = append(result, out[j])
+                }
+            }
+            i = runEnd
+            continue
+        }
+        result = append(result, out[i])
+        i++
+    }
+    return result
+}
+
+// singleLetterRun returns the end of a run of at least three single letters
+// separated by single spaces starting at i, or i when there is none
+func singleLetterRun(chars []char, i int) int {
+    if i > 0 && chars[i-1].r != ' ' {
+        return i
+    }
+
+    letters := 0
+    j := i
+    for letterAt(chars, j) && !letterAt(chars, j+1) {
+        letters++
+        j++
+        if j < len(chars) && chars[j].r == ' ' && letterAt(chars, j+1) && !letterAt(chars, j+2) {
+            j++
+            continue
+        }
+        break
+    }
+
+    if letters < 3 {
+        return i
+    }
+    return j
+}
+
+// collapseRepeats shortens a letter repeated three or more times to a single
+// letter ("fuuuuck" becomes "fuck"); the kept letter covers the whole run
+func collapseRepeats(chars []char) []char {
+    out := make([]char, 0, len(chars))
+    for i := 0; i < len(chars); {
+        j := i + 1
+        for j < len(chars) && unicode.ToLower(chars[j].r) == unicode.ToLower(chars[i].r) {
+            j++
+        }
+        if j-i >= 3 && unicode.IsLetter(chars[i].r) {
+            out = append(out, char{r: chars[i].r, span: Span{Start: chars[i].span.Start, End: chars[j-1].span.End}})
+        } else {
+            out = append(out, chars[i:j]...)
+        }
+        i = j
+    }
+    return out
+}
+
+// collapseSpaces turns runs of whitespace into a single space
+func collapseSpaces(chars []char) []char {
+    out := make([]char, 0, len(chars))
+    for i, c := range chars {
+        if c.r == ' ' && i > 0 && chars[i-1].r == ' ' {
+            continue
+        }
+        out = append(out, c)
+    }
+    return out
+}
+
+// letterAt reports whether chars[i] exists and is a letter
+func letterAt(chars []char, i int) bool {
+    return i >= 0 && i < len(chars) && unicode.IsLetter(chars[i].r)
+}
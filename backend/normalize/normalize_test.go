@@ -0,0 +1,125 @@
+package normalize
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestNormalize(t *testing.T) {
+    tests := []struct {
+        name string
+        in   string
+        want string
+    }{
+        // Leetspeak
+        {"leet digits", "you are 5tup1d", "you are stupid"},
+        {"numbers on their own are kept", "4 apples cost 100%", "4 apples cost 100%"},
+        {"leet symbols", "a$$hole", "asshole"},
+        {"trailing dollars", "what an a$$", "what an ass"},
+        {"mentions are kept", "@sam is a l0ser", "@sam is a loser"},
+
+        // Separators
+        {"dots between letters", "s.t.u.p.i.d", "stupid"},
+        {"hyphen inside a word", "stu-pid", "stupid"},
+        {"spaced out letters", "s t u p i d", "stupid"},
+        {"two single letters are kept", "a b", "a b"},
+        {"repeated letters", "fuuuuuck", "fuck"},
+        {"whitespace runs", "too   many\tspaces", "too many spaces"},
+
+        // Invisible characters and look-alikes
+        {"zero-width space", "st\u200bupid", "stupid"},
+        {"soft hyphen", "idi\u00adot", "idiot"},
+        {"cyrillic look-alikes", "ѕтupid", "stupid"},
+        {"fullwidth letters", "ｓｔｕｐｉｄ", "stupid"},
+        {"diacritics", "naïve café", "naive cafe"},
+        {"ligatures", "straße ﬁne", "strasse fine"},
+
+        // Lossy on purpose: the lexicon only needs the letters, model
+        // providers are given the original
+        {"urls are squashed", "www.example.com", "wexamplecom"},
+        {"apostrophes are dropped", "you're", "youre"},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            result := Normalize(test.in)
+            if result.Text != test.want {
+                t.Errorf("Normalize(%q) = %q, want %q", test.in, result.Text, test.want)
+            }
+            if result.Original != test.in {
+                t.Errorf("Original = %q, want %q", result.Original, test.in)
+            }
+            if len(result.Map) != len(result.Text) {
+                t.Errorf("map has %d entries for %d bytes", len(result.Map), len(result.Text))
+            }
+            if result.Changed() != (test.in != test.want) {
+                t.Errorf("Changed() = %v", result.Changed())
+            }
+        })
+    }
+}
+
+func TestOriginalRange(t *testing.T) {
+    tests := []struct {
+        name string
+        in   string
+        word string
+        want string
+    }{
+        {"leet word", "you are 5tup1d", "stupid", "5tup1d"},
+        {"separated letters", "what a s.t.u.p.i.d idea", "stupid", "s.t.u.p.i.d"},
+        {"zero-width space inside", "st\u200bupid", "stupid", "st\u200bupid"},
+        {"multi-byte look-alikes", "hi ｓｔｕｐｉｄ", "stupid", "ｓｔｕｐｉｄ"},
+        {"collapsed repeats", "so fuuuuuck off", "fuck", "fuuuuuck"},
+        {"ligature", "straße", "ss", "ß"},
+        {"after squashed spaces", "a   b  idiot", "idiot", "idiot"},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            result := Normalize(test.in)
+            index := strings.Index(result.Text, test.word)
+            if index < 0 {
+                t.Fatalf("%q not found in %q", test.word, result.Text)
+            }
+            start, end := result.OriginalRange(index, index+len(test.word))
+            if got := test.in[start:end]; got != test.want {
+                t.Errorf("original of %q = %q, want %q", test.word, got, test.want)
+            }
+        })
+    }
+}
+
+func TestOffsetMap(t *testing.T) {
+    // "ѕ" is two bytes, the "u" run collapses to one letter and the zero
+    // width space (three bytes) disappears
+    result := Normalize("ѕ.t.u.u.u.p\u200bid!")
+    if result.Text != "stupid!" {
+        t.Fatalf("Text = %q", result.Text)
+    }
+    want := []Span{{0, 2}, {3, 4}, {5, 10}, {11, 12}, {15, 16}, {16, 17}, {17, 18}}
+    if !reflect.DeepEqual(result.Map, want) {
+        t.Errorf("Map = %v, want %v", result.Map, want)
+    }
+}
+
+func TestOriginalRangeBounds(t *testing.T) {
+    result := Normalize("hello")
+    tests := []struct {
+        name       string
+        start, end int
+        want       [2]int
+    }{
+        {"whole text", 0, 5, [2]int{0, 5}},
+        {"clamped", -3, 99, [2]int{0, 5}},
+        {"empty range", 2, 2, [2]int{2, 2}},
+        {"past the end", 7, 7, [2]int{5, 5}},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            start, end := result.OriginalRange(test.start, test.end)
+            if [2]int{start, end} != test.want {
+                t.Errorf("OriginalRange(%d, %d) = %d, %d, want %v", test.start, test.end, start, end, test.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,260 @@
+// Package policy decides what happens to content once it has been
+// analyzed. A policy is a list of declarative rules such as
+//
+//    {"name": "threats", "when": "threat > 0.5", "action": "hold", "notify": true}
+//
+// "when" joins conditions with "and". A comparison has an analyzer category
+// (threat, insult, ...), "score" for the overall score or a signal on the
+// left and a number on the right; category scores and "score" run from 0 to
+// 1. "severity" is compared against severity names ("severity >= high"). A
+// bare name such as "repeated_target" holds when that signal is set, and
+// "not repeated_target" when it is not. Values that were not supplied are 0.
+//
+// Every rule that holds is reported and the strictest action wins.
+package policy
+
+import (
+    "embed"
+    "encoding/json"
+    "fmt"
+    "regexp"
+    "strconv"
+    "strings"
+    "sync/atomic"
+)
+
+//go:embed default.json
+var defaults embed.FS
+
+// Action is what happens to content
+type Action string
+
+const (
+    // ActionAllow publishes the content
+    ActionAllow Action = "allow"
+    // ActionFlag publishes the content and flags it for review
+    ActionFlag Action = "flag"
+    // ActionShadowHide keeps the content visible to its author only
+    ActionShadowHide Action = "shadow_hide"
+    // ActionHold keeps the content out of publication until a moderator reviews it
+    ActionHold Action = "hold"
+    // ActionReject refuses the content, nothing is saved
+    ActionReject Action = "reject"
+)
+
+// actionRank orders actions from least to most strict
+var actionRank = map[Action]int{
+    ActionAllow:      0,
+    ActionFlag:       1,
+    ActionShadowHide: 2,
+    ActionHold:       3,
+    ActionReject:     4,
+}
+
+// Flags reports whether the action puts the content in front of moderators
+func (a Action) Flags() bool {
+    return actionRank[a] > 0
+}
+
+// severityValues lets rules compare severities by name
+var severityValues = map[string]float64{
+    "none":     0,
+    "low":      1,
+    "medium":   2,
+    "high":     3,
+    "critical": 4,
+}
+
+// SeverityValue returns the numeric value of a severity name
+func SeverityValue(severity string) float64 {
+    return severityValues[strings.ToLower(severity)]
+}
+
+// Rule maps a condition on the analysis to an action
+type Rule struct {
+    Name   string `json:"name"`
+    When   string `json:"when"`
+    Action Action `json:"action"`
+    // Notify asks for moderators to be told when the rule fires
+    Notify bool `json:"notify,omitempty"`
+
+    conditions []condition
+}
+
+// condition is one parsed part of Rule.When
+type condition struct {
+    name  string
+    op    string // "" for a bare signal, "not" for a negated one
+    value float64
+}
+
+// Policy is a compiled, versioned set of rules
+type Policy struct {
+    Version int    `json:"version"`
+    Rules   []Rule `json:"rules"`
+}
+
+// Values are the inputs a policy is evaluated against, keyed by category,
+// "score", "severity" or signal name
+type Values map[string]float64
+
+// Decision is the outcome of evaluating a policy
+type Decision struct {
+    Action        Action   `json:"action"`
+    Notify        bool     `json:"notify"`
+    Matched       []string `json:"matched_rules"`
+    PolicyVersion int      `json:"policy_version"`
+}
+
+var (
+    comparison = regexp.MustCompile(`^([a-z_][a-z0-9_]*)\s*(>=|<=|==|!=|>|<)\s*([a-z0-9_.]+)$`)
+    signal     = regexp.MustCompile(`^(not\s+)?([a-z_][a-z0-9_]*)$`)
+    and        = regexp.MustCompile(`\s+and\s+`)
+)
+
+// Compile validates rules and returns a policy ready to evaluate
+func Compile(version int, rules []Rule) (*Policy, error) {
+    if len(rules) == 0 {
+        return nil, fmt.Errorf("a policy needs at least one rule")
+    }
+
+    p := &Policy{Version: version, Rules: make([]Rule, len(rules))}
+    for i, rule := range rules {
+        rule.Name = strings.TrimSpace(rule.Name)
+        if rule.Name == "" {
+            return nil, fmt.Errorf("rule %d needs a name", i+1)
+        }
+        if _, ok := actionRank[rule.Action]; !ok {
+            return nil, fmt.Errorf("rule %q: unknown action %q", rule.Name, rule.Action)
+        }
+
+        when := strings.ToLower(strings.TrimSpace(rule.When))
+        if when == "" {
+            return nil, fmt.Errorf("rule %q needs a condition", rule.Name)
+        }
+        rule.conditions = nil
+        for _, part := range and.Split(when, -1) {
+            c, err := parseCondition(strings.TrimSpace(part))
+            if err != nil {
+                return nil, fmt.Errorf("rule %q: %v", rule.Name, err)
+            }
+            rule.conditions = append(rule.conditions, c)
+        }
+        p.Rules[i] = rule
+    }
+    return p, nil
+}
+
+// parseCondition parses a single comparison or signal
+func parseCondition(text string) (condition, error) {
+    if m := comparison.FindStringSubmatch(text); m != nil {
+        value, err := strconv.ParseFloat(m[3], 64)
+        if err != nil {
+            severity, ok := severityValues[m[3]]
+            if !ok {
+                return condition{}, fmt.Errorf("%q is not a number or severity", m[3])
+            }
+            value = severity
+        }
+        return condition{name: m[1], op: m[2], value: value}, nil
+    }
+
+    if m := signal.FindStringSubmatch(text); m != nil {
+        if m[1] != "" {
+            return condition{name: m[2], op: "not"}, nil
+        }
+        return condition{name: m[2]}, nil
+    }
+
+    return condition{}, fmt.Errorf("cannot parse condition %q", text)
+}
+
+// holds reports whether the condition is true for values
+func (c condition) holds(values Values) bool {
+    v := values[c.name]
+    switch c.op {
+    case "":
+        return v > 0
+    case "not":
+        return v <= 0
+    case ">":
+        return v > c.value
+    case ">=":
+        return v >= c.value
+    case "<":
+        return v < c.value
+    case "<=":
+        return v <= c.value
+    case "==":
+        return v == c.value
+    case "!=":
+        return v != c.value
+    }
+    return false
+}
+
+// Evaluate runs every rule against values
+func (p *Policy) Evaluate(values Values) Decision {
+    decision := Decision{Action: ActionAllow, Matched: []string{}, PolicyVersion: p.Version}
+
+    for _, rule := range p.Rules {
+        matched := true
+        for _, c := range rule.conditions {
+            if !c.holds(values) {
+                matched = false
+                break
+            }
+        }
+        if !matched {
+            continue
+        }
+
+        decision.Matched = append(decision.Matched, rule.Name)
+        if actionRank[rule.Action] > actionRank[decision.Action] {
+            decision.Action = rule.Action
+        }
+        if rule.Notify {
+            decision.Notify = true
+        }
+    }
+    return decision
+}
+
+// DefaultRules returns the built-in rules, used until an admin saves a policy
+func DefaultRules() []Rule {
+    data, err := defaults.ReadFile("default.json")
+    if err != nil {
+        panic(err)
+    }
+
+    var file struct {
+        Rules []Rule `json:"rules"`
+    }
+    if err := json.Unmarshal(data, &file); err != nil {
+        panic(fmt.Sprintf("invalid default policy: %v", err))
+    }
+    return file.Rules
+}
+
+var active atomic.Pointer[Policy]
+
+// Active returns the policy currently in use, the default rules when none
+// has been set
+func Active() *Policy {
+    p := active.Load()
+    if p == nil {
+        var err error
+        p, err = Compile(0, DefaultRules())
+        if err != nil {
+            panic(fmt.Sprintf("invalid default policy: %v", err))
+        }
+        active.CompareAndSwap(nil, p)
+        p = active.Load()
+    }
+    return p
+}
+
+// SetActive swaps in a new policy
+func SetActive(p *Policy) {
+    active.Store(p)
+}
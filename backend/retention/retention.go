@@ -0,0 +1,122 @@
+// Package retention permanently removes soft-deleted posts and comments
+// once they have been kept for the retention period.
+//
+// Deleted posts and comments stay in the database, hidden from users, so
+// moderators can still see what was said. After POST_RETENTION_DAYS
+// (default 90) the post and its analyses, revisions, comments and queue
+// items are purged, and so are deleted comments on their own. Content that
+// is part of an exported evidence case is under legal hold and never
+// purged, and content with a pending appeal or an active strike waits
+// until the appeal is decided and the strike has expired. The moderation audit log is append-only and keeps its own
+// snapshots.
+package retention
+
+import (
+    "log"
+    "strconv"
+    "time"
+
+    "github.com/elham-abdu/cyberbullyprevention/config"
+    "github.com/elham-abdu/cyberbullyprevention/models"
+    "github.com/elham-abdu/cyberbullyprevention/strikes"
+    "gorm.io/gorm"
+)
+
+// defaultRetentionDays is used when POST_RETENTION_DAYS is not set
+const defaultRetentionDays = 90
+
+// Period is how long deleted posts are kept, from POST_RETENTION_DAYS.
+// Zero means deleted posts are kept forever.
+func Period() time.Duration {
+    days, err := strconv.Atoi(config.GetEnvOrDefault("POST_RETENTION_DAYS", strconv.Itoa(defaultRetentionDays)))
+    if err != nil || days < 0 {
+        days = defaultRetentionDays
+    }
+    return time.Duration(days) * 24 * time.Hour
+}
+
+// Purge permanently deletes the posts and comments soft-deleted before
+// cutoff, together with the rows that belong to them. Comments on a purged
+// post go with it. Content under legal hold or with a strike issued since
+// strikesSince that was not revoked is kept, and so is a post with a pending
+// appeal or with a comment that is kept. It returns the number of posts and
+// comments purged.
+func Purge(db *gorm.DB, cutoff, strikesSince time.Time) (int, error) {
+    struck := func(column string) *gorm.DB {
+        return db.Model(&models.Strike{}).Select(column).
+            Where(column+" IS NOT NULL AND revoked_at IS NULL AND created_at >= ?", strikesSince)
+    }
+    keptComments := db.Unscoped().Model(&models.Comment{}).Select("post_id").
+        Where("legal_hold OR id IN (?)", struck("comment_id"))
+    pendingAppeals := db.Model(&models.Appeal{}).Select("post_id").Where("status = ?", models.AppealPending)
+
+    var ids []uint
+    err := db.Unscoped().Model(&models.Post{}).
+        Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+        Where("NOT legal_hold AND id NOT IN (?)", keptComments).
+        Where("id NOT IN (?) AND id NOT IN (?)", pendingAppeals, struck("post_id")).
+        Pluck("id", &ids).Error
+    if err != nil {
+        return 0, err
+    }
+    var commentIDs []uint
+    err = db.Unscoped().Model(&models.Comment{}).
+        Where("(deleted_at IS NOT NULL AND deleted_at < ?) OR post_id IN ?", cutoff, ids).
+        Where("NOT legal_hold AND id NOT IN (?)", struck("comment_id")).
+        Pluck("id", &commentIDs).Error
+    if err != nil || len(ids)+len(commentIDs) == 0 {
+        return 0, err
+    }
+
+    err = db.Transaction(func(tx *gorm.DB) error {
+        items := tx.Model(&models.ModerationQueueItem{}).Select("id").Where("post_id IN ? OR comment_id IN ?", ids, commentIDs)
+        if err := tx.Where("item_id IN (?)", items).Delete(&models.QueueSkip{}).Error; err != nil {
+            return err
+        }
+        for _, model := range []interface{}{&models.ModerationQueueItem{}, &models.PostAnalysis{}, &models.Interaction{}} {
+            if err := tx.Where("comment_id IN ?", commentIDs).Delete(model).Error; err != nil {
+                return err
+            }
+        }
+        if err := tx.Unscoped().Where("id IN ?", commentIDs).Delete(&models.Comment{}).Error; err != nil {
+            return err
+        }
+
+        dependents := []interface{}{&models.ModerationQueueItem{}, &models.PostRevision{}, &models.PostAnalysis{}, &models.Interaction{}}
+        for _, model := range dependents {
+            if err := tx.Where("post_id IN ?", ids).Delete(model).Error; err != nil {
+                return err
+            }
+        }
+        return tx.Unscoped().Where("id IN ?", ids).Delete(&models.Post{}).Error
+    })
+    if err != nil {
+        return 0, err
+    }
+    return len(ids) + len(commentIDs), nil
+}
+
+// Run purges expired posts now and then every interval. It returns at once
+// when retention is disabled.
+func Run(interval time.Duration) {
+    period := Period()
+    if period == 0 {
+        log.Println("Post retention disabled, deleted posts are kept forever")
+        return
+    }
+
+    settings := strikes.SettingsFromEnv()
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        now := time.Now()
+        purged, err := Purge(config.DB, now.Add(-period), settings.ActiveSince(now))
+        if err != nil {
+            log.Printf("Purging deleted posts failed: %v", err)
+        } else if purged > 0 {
+            log.Printf("Purged %d posts and comments deleted more than %s ago", purged, period)
+        }
+        <-ticker.C
+    }
+}
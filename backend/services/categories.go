@@ -0,0 +1,73 @@
+package services
+
+import (
+    "strings"
+)
+
+// Canonical category keys shared by every provider. IBM, the ML service and
+// the rule-based analyzers all name their categories a little differently.
+const (
+    CategoryToxicity       = "toxicity"
+    CategorySevereToxicity = "severe_toxicity"
+    CategoryObscene        = "obscene"
+    CategoryThreat         = "threat"
+    CategoryInsult         = "insult"
+    CategoryIdentityHate   = "identity_hate"
+)
+
+// categoryAliases maps provider category names onto canonical keys
+var categoryAliases = map[string]string{
+    "toxicity":        CategoryToxicity,
+    "toxic":           CategoryToxicity,
+    "severe toxicity": CategorySevereToxicity,
+    "severe_toxic":    CategorySevereToxicity,
+    "obscene":         CategoryObscene,
+    "profanity":       CategoryObscene,
+    "threat":          CategoryThreat,
+    "threats":         CategoryThreat,
+    "insult":          CategoryInsult,
+    "insults":         CategoryInsult,
+    "identity hate":   CategoryIdentityHate,
+    "identity attack": CategoryIdentityHate,
+    "identity_attack": CategoryIdentityHate,
+    "hate speech":     CategoryIdentityHate,
+}
+
+// categoryInfo holds the display name and description of canonical categories
+var categoryInfo = map[string]ToxicityCategory{
+    CategoryToxicity:       {Name: "Toxicity", Description: "General toxic content"},
+    CategorySevereToxicity: {Name: "Severe Toxicity", Description: "Extremely toxic content"},
+    CategoryObscene:        {Name: "Obscene", Description: "Obscene or vulgar language"},
+    CategoryThreat:         {Name: "Threat", Description: "Threatening content"},
+    CategoryInsult:         {Name: "Insult", Description: "Insulting language"},
+    CategoryIdentityHate:   {Name: "Identity Hate", Description: "Attacks based on identity"},
+}
+
+// CanonicalCategory returns the canonical key for a provider category name
+func CanonicalCategory(name string) string {
+    key := strings.ToLower(strings.TrimSpace(name))
+    if canonical, ok := categoryAliases[key]; ok {
+        return canonical
+    }
+    if canonical, ok := categoryAliases[strings.ReplaceAll(key, "_", " ")]; ok {
+        return canonical
+    }
+    return strings.ReplaceAll(key, " ", "_")
+}
+
+// severityRank orders severity labels from least to most severe
+var severityRank = map[string]int{
+    "none":     0,
+    "low":      1,
+    "medium":   2,
+    "high":     3,
+    "critical": 4,
+}
+
+// maxSeverity returns the more severe of two severity labels
+func maxSeverity(a, b string) string {
+    if severityRank[b] > severityRank[a] {
+        return b
+    }
+    return a
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+    "math"
+    "regexp"
+    "time"
+)
+
+// ContextMessage is an earlier message of the conversation around the
+// content being analyzed
+type ContextMessage struct {
+    AuthorID uint   `json:"author_id"`
+    Content  string `json:"content"`
+    // Score is the toxicity score (0-100) the message got when it was posted
+    Score     float64   `json:"score"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// AnalysisContext is the conversation a message belongs to
+type AnalysisContext struct {
+    // AuthorID wrote the message being analyzed
+    AuthorID uint
+    // Parent is the message being replied to, nil for a new thread
+    Parent *ContextMessage
+    // History holds the recent messages between the same participants,
+    // oldest first
+    History []ContextMessage
+}
+
+// messages returns the parent and the history together
+func (c AnalysisContext) messages() []ContextMessage {
+    messages := c.History
+    if c.Parent != nil {
+        messages = append([]ContextMessage{*c.Parent}, messages...)
+    }
+    return messages
+}
+
+// ContextAnalyzer is implemented by providers that can score a message
+// within its conversation, catching what a single message does not show:
+// sarcasm, threats that only make sense as a reply, and insults the author
+// is quoting to report them
+type ContextAnalyzer interface {
+    AnalyzeWithContext(content string, context AnalysisContext) (*ToxicityResult, error)
+}
+
+// ContextDetails describes how the conversation changed a result
+type ContextDetails struct {
+    Parent  bool `json:"parent"`
+    History int  `json:"history"`
+    // ReportedQuotes counts the quotations the author is reporting
+    ReportedQuotes int `json:"reported_quotes"`
+    // ScoreAlone is what the message scored without its context
+    ScoreAlone  float64  `json:"score_alone"`
+    Adjustments []string `json:"adjustments"`
+}
+
+const (
+    // quotedWeight is how much toxicity inside a reported quotation counts
+    quotedWeight = 0.25
+    // heatedScore is the score from which a message of the conversation
+    // makes it heated
+    heatedScore = 40
+    // replyThreatScore and heatedThreatScore are the threat scores of a
+    // threatening reply, in a calm and in a heated conversation
+    replyThreatScore  = 60
+    heatedThreatScore = 80
+    // sarcasmInsultScore is the insult score of sarcasm in a heated
+    // conversation
+    sarcasmInsultScore = 45
+)
+
+var (
+    // quotePattern finds quotations: text in straight or curly double
+    // quotes, and lines quoted e-mail style with ">"
+    quotePattern = regexp.MustCompile(`(?m)"[^"\n]{2,}"|“[^”\n]{2,}”|^>[^\n]*`)
+    // reportingPattern finds words showing the author is passing on what
+    // someone else said
+    reportingPattern = regexp.MustCompile(`(?i)\b(said|says|saying|called me|calls me|calling me|told me|tells me|wrote|posted|sent me|messaged me|texted me|dm'?d me|reported|reporting|report|screenshot)\b`)
+    // replyThreatPattern finds phrases that threaten when aimed at someone
+    // but are harmless on their own
+    replyThreatPattern = regexp.MustCompile(`(?i)\b(see what happens|you'?ll regret|you will regret|watch your back|i know where you live|you'?re dead|you are dead)\b`)
+    // secondPersonPattern finds words addressing the reader directly
+    secondPersonPattern = regexp.MustCompile(`(?i)\b(you|your|you'?re|yours|yourself|u|ur)\b`)
+    // sarcasmPattern finds praise that is often meant the other way round
+    sarcasmPattern = regexp.MustCompile(`(?i)\b(yeah right|sure you (are|did|do)|nice one|good job|great job|well done|so smart|genius|bravo|congrats)\b|/s\b|🙄|👏`)
+)
+
+// analyzeInContext is the context-aware scoring mode shared by the rule
+// engine and the model adapters. Reported quotations are scored by running
+// service again over the content with them blanked out; the conversation
+// then decides whether sarcasm and reply-only threats count.
+func analyzeInContext(service ToxicityService, content string, context AnalysisContext) (*ToxicityResult, error) {
+    result, err := service.Analyze(content)
+    if err != nil {
+        return nil, err
+    }
+    details := &ContextDetails{
+        Parent:      context.Parent != nil,
+        History:     len(context.History),
+        ScoreAlone:  result.Score,
+        Adjustments: []string{},
+    }
+
+    quotes := reportedQuotes(content)
+    if len(quotes) > 0 {
+        unquoted, err := service.Analyze(blankOut(content, quotes))
+        if err != nil {
+            return nil, err
+        }
+        discountRanges(result, unquoted, quotes, quotedWeight)
+        details.ReportedQuotes = len(quotes)
+        details.Adjustments = append(details.Adjustments, "toxicity inside reported quotations lowered")
+    }
+
+    // Phrases inside quotations are not the author's own words
+    own := blankOut(content, quotePattern.FindAllStringIndex(content, -1))
+    heated := heatedConversation(context)
+
+    // A threatening phrase in a reply only counts with another sign of
+    // hostility: a heated conversation, or the reply addressing someone
+    aimed := heated || secondPersonPattern.MatchString(own)
+    if context.Parent != nil && context.Parent.AuthorID != context.AuthorID && aimed {
+        if match := replyThreatPattern.FindStringIndex(own); match != nil {
+            score, severity := float64(replyThreatScore), "high"
+            if heated {
+                score, severity = heatedThreatScore, "critical"
+            }
+            raiseCategory(result, CategoryThreat, score, content, match)
+            result.Severity = maxSeverity(result.Severity, severity)
+            details.Adjustments = append(details.Adjustments, "threatening reply")
+        }
+    }
+
+    if heated {
+        if match := sarcasmPattern.FindStringIndex(own); match != nil {
+            raiseCategory(result, CategoryInsult, sarcasmInsultScore, content, match)
+            result.Sentiment = "negative"
+            details.Adjustments = append(details.Adjustments, "sarcasm in a heated conversation")
+        }
+    }
+
+    result.Context = details
+    return result, nil
+}
+
+// reportedQuotes returns the byte ranges of the quotations in content when
+// the author is reporting them, e.g. `he called me "a loser"`
+func reportedQuotes(content string) [][]int {
+    quotes := quotePattern.FindAllStringIndex(content, -1)
+    if len(quotes) == 0 || !reportingPattern.MatchString(blankOut(content, quotes)) {
+        return nil
+    }
+    return quotes
+}
+
+// blankOut replaces the byte ranges of content with spaces, so offsets into
+// the result still point at the same text
+func blankOut(content string, ranges [][]int) string {
+    if len(ranges) == 0 {
+        return content
+    }
+    blanked := []byte(content)
+    for _, r := range ranges {
+        for i := r[0]; i < r[1]; i++ {
+            blanked[i] = ' '
+        }
+    }
+    return string(blanked)
+}
+
+// discountRanges lowers the scores of result, the analysis of the whole
+// content, toward unquoted, the analysis with ranges blanked out, so what
+// was found inside the ranges only counts for weight
+func discountRanges(result, unquoted *ToxicityResult, ranges [][]int, weight float64) {
+    blend := func(whole, without float64) float64 {
+        if whole <= without {
+            return whole
+        }
+        return without + (whole-without)*weight
+    }
+
+    without := map[string]float64{}
+    for _, category := range unquoted.Categories {
+        key := CanonicalCategory(category.Name)
+        without[key] = math.Max(without[key], category.Score)
+    }
+    for i := range result.Categories {
+        category := &result.Categories[i]
+        category.Score = blend(category.Score, without[CanonicalCategory(category.Name)])
+    }
+    for i := range result.Detections {
+        detection := &result.Detections[i]
+        for _, r := range ranges {
+            if detection.Start >= r[0] && detection.End <= r[1] {
+                detection.Score *= weight
+                break
+            }
+        }
+    }
+
+    if result.Score > unquoted.Score {
+        result.Score = blend(result.Score, unquoted.Score)
+        result.Severity = unquoted.Severity
+        result.Sentiment = unquoted.Sentiment
+    }
+}
+
+// heatedConversation reports whether any message around the content was
+// hostile
+func heatedConversation(context AnalysisContext) bool {
+    for _, message := range context.messages() {
+        if message.Score >= heatedScore {
+            return true
+        }
+    }
+    return false
+}
+
+// raiseCategory lifts a category to at least score, marks the span as a
+// detection and pulls the overall score up with it. Whether that flags the
+// content is up to the moderation policy.
+func raiseCategory(result *ToxicityResult, key string, score float64, content string, span []int) {
+    found := false
+    for i := range result.Categories {
+        category := &result.Categories[i]
+        if CanonicalCategory(category.Name) == key {
+            category.Score = math.Max(category.Score, score)
+            category.Detected = true
+            found = true
+        }
+    }
+    if !found {
+        info := categoryInfo[key]
+        result.Categories = append(result.Categories, ToxicityCategory{
+            Name:        info.Name,
+            Score:       score,
+            Detected:    true,
+            Description: info.Description,
+        })
+    }
+
+    text := content[span[0]:span[1]]
+    result.ToxicWords = append(result.ToxicWords, text)
+    result.Detections = append(result.Detections, Detection{
+        Start:    span[0],
+        End:      span[1],
+        Text:     text,
+        Category: key,
+        Source:   "context",
+        Score:    score,
+    })
+    result.Score = math.Max(result.Score, score*0.75)
+    result.Severity = maxSeverity(result.Severity, getSeverity(result.Score))
+}
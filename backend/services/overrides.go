@@ -0,0 +1,161 @@
+package services
+
+import (
+    "fmt"
+    "math"
+    "strings"
+
+    "github.com/elham-abdu/cyberbullyprevention/lexicon"
+    "github.com/elham-abdu/cyberbullyprevention/normalize"
+)
+
+// customBlockScore is the minimum overall score of content that contains a
+// moderator-blocked term, high enough for the default policy to flag it
+const customBlockScore = 60
+
+// applyCustomTerms applies the moderator-managed lexicon terms on top of a
+// provider result. Terms are looked up in the normalized content and
+// reported at their place in the original. Blocked terms always raise the
+// score, whatever the model said; allowed terms are removed from the
+// reported toxic words and detections. The pipeline also scores content
+// again without the allowed terms, see allowedSpans. It is safe to apply
+// more than once.
+func applyCustomTerms(result *ToxicityResult, normalized normalize.Result) {
+    lex := lexicon.Active()
+    if lex.Custom == nil {
+        return
+    }
+
+    // Drop reported words that moderators allowed
+    if len(lex.CustomAllow) > 0 {
+        words := result.ToxicWords[:0]
+        for _, word := range result.ToxicWords {
+            if !isAllowedTerm(word, lex.CustomAllow) {
+                words = append(words, word)
+            }
+        }
+        result.ToxicWords = words
+
+        spans := allowedSpans(normalized)
+        detections := result.Detections[:0]
+        for _, detection := range result.Detections {
+            if !isAllowedTerm(detection.Text, lex.CustomAllow) && !withinSpans(detection, spans) {
+                detections = append(detections, detection)
+            }
+        }
+        result.Detections = detections
+    }
+
+    matches := findTerms(lex.Custom, normalized)
+    if len(matches) == 0 {
+        return
+    }
+
+    for _, match := range matches {
+        category := CanonicalCategory(match.Category)
+        score := math.Min(100, customBlockScore*match.Weight)
+
+        found := false
+        for i := range result.Categories {
+            if CanonicalCategory(result.Categories[i].Name) == category {
+                result.Categories[i].Score = math.Max(result.Categories[i].Score, score)
+                result.Categories[i].Detected = true
+                found = true
+            }
+        }
+        if !found {
+            info, ok := categoryInfo[category]
+            if !ok {
+                info = ToxicityCategory{Name: category}
+            }
+            info.Score = score
+            info.Detected = true
+            result.Categories = append(result.Categories, info)
+        }
+
+        if !containsWord(result.ToxicWords, match.Text) {
+            result.ToxicWords = append(result.ToxicWords, match.Text)
+        }
+        if !hasDetection(result.Detections, match.Start, match.End, match.Source) {
+            detection := matchDetection(match)
+            detection.Category = category
+            detection.Score = score
+            result.Detections = append(result.Detections, detection)
+        }
+
+        severity := match.Severity
+        if severity == "" {
+            severity = "medium"
+        }
+        result.Severity = maxSeverity(result.Severity, severity)
+        result.Score = math.Max(result.Score, score)
+    }
+
+    note := fmt.Sprintf("Content contains %d term(s) blocked by moderators.", len(matches))
+    if !containsWord(result.Suggestions, note) {
+        result.Suggestions = append(result.Suggestions, note)
+    }
+}
+
+// allowedSpans returns the byte ranges of the original content covered by
+// terms moderators allowed
+func allowedSpans(normalized normalize.Result) [][]int {
+    lex := lexicon.Active()
+    if lex.Allowed == nil {
+        return nil
+    }
+    spans := [][]int{}
+    for _, match := range findTerms(lex.Allowed, normalized) {
+        spans = append(spans, []int{match.Start, match.End})
+    }
+    return spans
+}
+
+// withinSpans reports whether the detection lies inside one of spans
+func withinSpans(detection Detection, spans [][]int) bool {
+    for _, span := range spans {
+        if detection.Start >= span[0] && detection.End <= span[1] {
+            return true
+        }
+    }
+    return false
+}
+
+// isAllowedTerm reports whether word is one of the allowed terms
+func isAllowedTerm(word string, allowed []string) bool {
+    word = strings.ToLower(strings.TrimSpace(word))
+    for _, term := range allowed {
+        term = strings.ToLower(strings.TrimSpace(term))
+        if stem := strings.TrimSuffix(term, "*"); stem != term {
+            if strings.HasPrefix(word, stem) {
+                return true
+            }
+            continue
+        }
+        if word == term {
+            return true
+        }
+    }
+    return false
+}
+
+// hasDetection reports whether a detection from source covers exactly
+// start to end
+func hasDetection(detections []Detection, start, end int, source string) bool {
+    for _, detection := range detections {
+        if detection.Start == start && detection.End == end && detection.Source == source {
+            return true
+        }
+    }
+    return false
+}
+
+// containsWord reports whether list contains word, ignoring case
+func containsWord(list []string, word string) bool {
+    for _, item := range list {
+        if strings.EqualFold(item, word) {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+    "strings"
+    "testing"
+
+    "github.com/elham-abdu/cyberbullyprevention/lexicon"
+)
+
+// wordModel scores content like a model that only reacts to one word
+type wordModel struct {
+    word string
+}
+
+func (m wordModel) Analyze(content string) (*ToxicityResult, error) {
+    result := &ToxicityResult{Score: 5, Severity: "none", Sentiment: "neutral"}
+    index := strings.Index(strings.ToLower(content), m.word)
+    if index < 0 {
+        result.Categories = []ToxicityCategory{{Name: "Insult", Score: 5}}
+        return result, nil
+    }
+    result.Score = 85
+    result.Severity = "high"
+    result.Categories = []ToxicityCategory{{Name: "Insult", Score: 85, Detected: true}}
+    result.Detections = []Detection{{Start: index, End: index + len(m.word), Text: content[index : index+len(m.word)], Category: CategoryInsult, Score: 85}}
+    return result, nil
+}
+
+func TestAllowedTermLiftsModelFlag(t *testing.T) {
+    lexicon.Init("")
+    pipeline := NewAnalyzerPipeline(PipelineProvider{Name: "model", Service: wordModel{word: "scunthorpe"}})
+
+    tests := []struct {
+        name    string
+        allow   []string
+        content string
+        flagged bool
+        score   float64
+    }{
+        {"model flag stands", nil, "See you in Scunthorpe", true, 85},
+        {"allowed term lifts the flag", []string{"scunthorpe"}, "See you in Scunthorpe", false, 5},
+        {"allowed stem lifts the flag", []string{"scunth*"}, "See you in Scunthorpe", false, 5},
+        {"other allowed terms change nothing", []string{"grimsby"}, "See you in Scunthorpe", true, 85},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            if err := lexicon.SetCustomTerms(test.name, nil, test.allow); err != nil {
+                t.Fatal(err)
+            }
+            defer lexicon.SetCustomTerms("", nil, nil)
+
+            result, err := pipeline.Analyze(test.content)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if result.IsFlagged != test.flagged {
+                t.Errorf("flagged = %v, want %v", result.IsFlagged, test.flagged)
+            }
+            if result.Score != test.score {
+                t.Errorf("score = %v, want %v", result.Score, test.score)
+            }
+            for _, category := range result.Categories {
+                if CanonicalCategory(category.Name) == CategoryInsult && category.Score != test.score {
+                    t.Errorf("insult score = %v, want %v", category.Score, test.score)
+                }
+            }
+            if !test.flagged && len(result.Detections) > 0 {
+                t.Errorf("detections = %v, want none", result.Detections)
+            }
+        })
+    }
+}
@@ -0,0 +1,362 @@
+﻿package services
+
+import (
+    "fmt"
+    "log"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+    "unicode/utf8"
+
+    "github.com/elham-abdu/cyberbullyprevention/config"
+    "github.com/elham-abdu/cyberbullyprevention/lexicon"
+    "github.com/elham-abdu/cyberbullyprevention/normalize"
+)
+
+// FallbackPolicy controls what the pipeline does when a provider fails
+type FallbackPolicy string
+
+const (
+    // FallbackNext moves on to the next provider in the list
+    FallbackNext FallbackPolicy = "next"
+    // FallbackFail stops the pipeline and returns the provider error
+    FallbackFail FallbackPolicy = "fail"
+)
+
+// PipelineProvider is one step of the analyzer pipeline
+type PipelineProvider struct {
+    Name     string
+    Service  ToxicityService
+    Timeout  time.Duration
+    Fallback FallbackPolicy
+}
+
+// ProviderAttempt records the outcome of calling a single provider
+type ProviderAttempt struct {
+    Provider  string `json:"provider"`
+    Error     string `json:"error,omitempty"`
+    LatencyMs int64  `json:"latency_ms"`
+}
+
+// AnalyzerPipeline runs an ordered list of providers and returns the first
+// successful result
+type AnalyzerPipeline struct {
+    providers []PipelineProvider
+}
+
+// NewAnalyzerPipeline creates a pipeline from an ordered list of providers
+func NewAnalyzerPipeline(providers ...PipelineProvider) *AnalyzerPipeline {
+    return &AnalyzerPipeline{providers: providers}
+}
+
+// Providers returns the configured provider names in order
+func (p *AnalyzerPipeline) Providers() []string {
+    names := make([]string, 0, len(p.providers))
+    for _, provider := range p.providers {
+        names = append(names, provider.Name)
+    }
+    return names
+}
+
+// Analyze runs the providers in order until one of them succeeds, then
+// applies the moderator terms and the moderation policy to the result.
+// Providers see the content as written; only lexicon lookups use the
+// normalized text.
+func (p *AnalyzerPipeline) Analyze(content string) (*ToxicityResult, error) {
+    return p.analyze(content, nil)
+}
+
+// AnalyzeWithContext is Analyze for a message within its conversation.
+// Providers that implement ContextAnalyzer get the context, the others
+// score the message alone.
+func (p *AnalyzerPipeline) AnalyzeWithContext(content string, context AnalysisContext) (*ToxicityResult, error) {
+    return p.analyze(content, &context)
+}
+
+// analyze runs the pipeline, with the conversation when context is not nil
+func (p *AnalyzerPipeline) analyze(content string, context *AnalysisContext) (*ToxicityResult, error) {
+    if len(p.providers) == 0 {
+        return nil, fmt.Errorf("no toxicity providers configured")
+    }
+
+    normalized := normalize.Normalize(content)
+
+    attempts := []ProviderAttempt{}
+    var lastErr error
+
+    for i, provider := range p.providers {
+        start := time.Now()
+        result, err := runProvider(provider, content, context)
+        attempt := ProviderAttempt{
+            Provider:  provider.Name,
+            LatencyMs: time.Since(start).Milliseconds(),
+        }
+
+        if err != nil {
+            attempt.Error = err.Error()
+            attempts = append(attempts, attempt)
+            lastErr = err
+            log.Printf("Toxicity provider %s failed: %v", provider.Name, err)
+
+            if provider.Fallback == FallbackFail {
+                return nil, fmt.Errorf("toxicity provider %s failed: %v", provider.Name, err)
+            }
+            continue
+        }
+
+        attempts = append(attempts, attempt)
+
+        // Score again without the terms moderators allowed, so whatever a
+        // model found only in them no longer counts
+        if spans := allowedSpans(normalized); len(spans) > 0 {
+            without, err := runProvider(provider, blankOut(content, spans), context)
+            if err != nil {
+                log.Printf("Toxicity provider %s failed without the allowed terms: %v", provider.Name, err)
+            } else {
+                discountRanges(result, without, spans, 0)
+            }
+        }
+
+        result.Provider = provider.Name
+        if versioned, ok := provider.Service.(VersionedService); ok {
+            result.ProviderVersion = versioned.Version()
+        }
+        result.FallbackUsed = i > 0
+        result.LatencyMs = attempt.LatencyMs
+        result.Attempts = attempts
+        if normalized.Changed() {
+            result.Normalized = normalized.Text
+        }
+        applyCustomTerms(result, normalized)
+        resolveDetections(result, content)
+        result.LexiconVersion = lexicon.Active().FullVersion()
+        ensureResultShape(result)
+        ApplyPolicy(result, nil)
+        return result, nil
+    }
+
+    return nil, fmt.Errorf("all toxicity providers failed, last error: %v", lastErr)
+}
+
+// runProvider calls a provider and enforces its timeout. Providers that
+// implement ContextAnalyzer are given context when there is one.
+func runProvider(provider PipelineProvider, content string, context *AnalysisContext) (*ToxicityResult, error) {
+    type outcome struct {
+        result *ToxicityResult
+        err    error
+    }
+
+    done := make(chan outcome, 1)
+    go func() {
+        var result *ToxicityResult
+        var err error
+        if analyzer, ok := provider.Service.(ContextAnalyzer); ok && context != nil {
+            result, err = analyzer.AnalyzeWithContext(content, *context)
+        } else {
+            result, err = provider.Service.Analyze(content)
+        }
+        if err == nil && result == nil {
+            err = fmt.Errorf("provider returned no result")
+        }
+        done <- outcome{result: result, err: err}
+    }()
+
+    if provider.Timeout <= 0 {
+        o := <-done
+        return o.result, o.err
+    }
+
+    timer := time.NewTimer(provider.Timeout)
+    defer timer.Stop()
+
+    select {
+    case o := <-done:
+        return o.result, o.err
+    case <-timer.C:
+        return nil, fmt.Errorf("timed out after %v", provider.Timeout)
+    }
+}
+
+// ensureResultShape makes sure list fields are never null in responses
+func ensureResultShape(result *ToxicityResult) {
+    if result.Categories == nil {
+        result.Categories = []ToxicityCategory{}
+    }
+    if result.ToxicWords == nil {
+        result.ToxicWords = []string{}
+    }
+    if result.Detections == nil {
+        result.Detections = []Detection{}
+    }
+    if result.Suggestions == nil {
+        result.Suggestions = []string{}
+    }
+}
+
+// resolveDetections turns detections from byte offsets into character
+// offsets into content, and drops duplicates reported for the same span and
+// category
+func resolveDetections(result *ToxicityResult, content string) {
+    resolved := make([]Detection, 0, len(result.Detections))
+    seen := map[string]int{}
+
+    for _, detection := range result.Detections {
+        start, end := detection.Start, detection.End
+        if start < 0 || end > len(content) || start >= end {
+            continue
+        }
+        detection.Text = content[start:end]
+        detection.Start = utf8.RuneCountInString(content[:start])
+        detection.End = detection.Start + utf8.RuneCountInString(detection.Text)
+
+        key := fmt.Sprintf("%d:%d:%s", detection.Start, detection.End, detection.Category)
+        if i, ok := seen[key]; ok {
+            if detection.Score > resolved[i].Score {
+                resolved[i].Score = detection.Score
+            }
+            continue
+        }
+        seen[key] = len(resolved)
+        resolved = append(resolved, detection)
+    }
+
+    sort.SliceStable(resolved, func(i, j int) bool {
+        if resolved[i].Start != resolved[j].Start {
+            return resolved[i].Start < resolved[j].Start
+        }
+        return resolved[i].End > resolved[j].End
+    })
+    result.Detections = resolved
+}
+
+// runeRangeToBytes converts a character range of text into a byte range
+func runeRangeToBytes(text string, start, end int) (int, int, bool) {
+    if start < 0 || end <= start {
+        return 0, 0, false
+    }
+
+    byteStart, byteEnd := -1, -1
+    index := 0
+    for offset := range text {
+        if index == start {
+            byteStart = offset
+        }
+        if index == end {
+            byteEnd = offset
+            break
+        }
+        index++
+    }
+    if byteEnd == -1 && index == end {
+        byteEnd = len(text)
+    }
+    if byteStart == -1 || byteEnd == -1 {
+        return 0, 0, false
+    }
+    return byteStart, byteEnd, true
+}
+
+// providerDefaults holds the built-in providers and their default timeouts
+var providerDefaults = map[string]struct {
+    service func() ToxicityService
+    timeout time.Duration
+}{
+    "ibm":   {service: func() ToxicityService { return GlobalIBMAnalyzer }, timeout: 10 * time.Second},
+    "ml":    {service: func() ToxicityService { return GlobalMLAnalyzer }, timeout: 5 * time.Second},
+    "rules": {service: func() ToxicityService { return NewRuleBasedAnalyzer() }, timeout: time.Second},
+}
+
+// defaultProvider looks up a provider by name, including the ensemble
+func defaultProvider(name string) (ToxicityService, time.Duration, bool) {
+    if name == "ensemble" {
+        return NewEnsembleFromEnv(), 12 * time.Second, true
+    }
+
+    defaults, ok := providerDefaults[name]
+    if !ok {
+        return nil, 0, false
+    }
+    return defaults.service(), defaults.timeout, true
+}
+
+// NewPipelineFromEnv builds the pipeline from environment variables.
+//
+// TOXICITY_PROVIDERS is a comma separated, ordered list of providers
+// (default "ibm,ml,rules"); "ensemble" runs several providers at once, see
+// NewEnsembleFromEnv. Each provider can override its timeout with
+// TOXICITY_<NAME>_TIMEOUT_MS and its fallback policy with
+// TOXICITY_<NAME>_FALLBACK ("next" or "fail").
+func NewPipelineFromEnv() *AnalyzerPipeline {
+    names := strings.Split(config.GetEnvOrDefault("TOXICITY_PROVIDERS", "ibm,ml,rules"), ",")
+
+    providers := []PipelineProvider{}
+    for _, name := range names {
+        name = strings.ToLower(strings.TrimSpace(name))
+        if name == "" {
+            continue
+        }
+
+        service, timeout, ok := defaultProvider(name)
+        if !ok {
+            log.Printf("Unknown toxicity provider %q, skipping", name)
+            continue
+        }
+
+        prefix := "TOXICITY_" + strings.ToUpper(name) + "_"
+        if ms, err := strconv.Atoi(config.GetEnvOrDefault(prefix+"TIMEOUT_MS", "")); err == nil {
+            timeout = time.Duration(ms) * time.Millisecond
+        }
+
+        fallback := FallbackPolicy(strings.ToLower(config.GetEnvOrDefault(prefix+"FALLBACK", string(FallbackNext))))
+        if fallback != FallbackNext && fallback != FallbackFail {
+            log.Printf("Unknown fallback policy %q for provider %s, using %q", fallback, name, FallbackNext)
+            fallback = FallbackNext
+        }
+
+        providers = append(providers, PipelineProvider{
+            Name:     name,
+            Service:  service,
+            Timeout:  timeout,
+            Fallback: fallback,
+        })
+    }
+
+    if len(providers) == 0 {
+        log.Println("No valid toxicity providers configured, using rule-based analysis")
+        providers = append(providers, PipelineProvider{
+            Name:     "rules",
+            Service:  NewRuleBasedAnalyzer(),
+            Timeout:  providerDefaults["rules"].timeout,
+            Fallback: FallbackFail,
+        })
+    }
+
+    return NewAnalyzerPipeline(providers...)
+}
+
+// GlobalPipeline is the pipeline used by every code path that scores content
+var GlobalPipeline *AnalyzerPipeline
+
+// InitPipeline builds GlobalPipeline from the environment
+func InitPipeline() {
+    GlobalPipeline = NewPipelineFromEnv()
+    log.Printf("Toxicity pipeline providers: %s", strings.Join(GlobalPipeline.Providers(), " -> "))
+}
+
+// AnalyzeContent scores content through the global pipeline
+func AnalyzeContent(content string) (*ToxicityResult, error) {
+    if GlobalPipeline == nil {
+        InitPipeline()
+    }
+    return GlobalPipeline.Analyze(content)
+}
+
+// AnalyzeInContext scores content within its conversation through the
+// global pipeline
+func AnalyzeInContext(content string, context AnalysisContext) (*ToxicityResult, error) {
+    if GlobalPipeline == nil {
+        InitPipeline()
+    }
+    return GlobalPipeline.AnalyzeWithContext(content, context)
+}
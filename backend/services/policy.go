@@ -0,0 +1,45 @@
+package services
+
+import (
+    "math"
+    "strings"
+
+    "github.com/elham-abdu/cyberbullyprevention/policy"
+)
+
+// PolicyValues turns a result into policy inputs: every canonical category
+// and the overall score on a 0-1 scale, the severity, and the signals
+// derived from the result. Extra signals, such as repeated_target, are
+// added on top.
+func PolicyValues(result *ToxicityResult, signals map[string]float64) policy.Values {
+    values := policy.Values{
+        "score":    result.Score / 100,
+        "severity": policy.SeverityValue(result.Severity),
+    }
+    for _, category := range result.Categories {
+        key := CanonicalCategory(category.Name)
+        values[key] = math.Max(values[key], category.Score/100)
+    }
+
+    for _, detection := range result.Detections {
+        if strings.HasPrefix(detection.Source, "lexicon:custom") {
+            values["custom_term"]++
+        }
+    }
+    values["detections"] = float64(len(result.Detections))
+
+    for name, value := range signals {
+        values[name] = value
+    }
+    return values
+}
+
+// ApplyPolicy evaluates the active moderation policy against result and
+// records the decision on it. Providers only score content, so IsFlagged
+// is set here and nowhere else.
+func ApplyPolicy(result *ToxicityResult, signals map[string]float64) policy.Decision {
+    decision := policy.Active().Evaluate(PolicyValues(result, signals))
+    result.Policy = &decision
+    result.IsFlagged = decision.Action.Flags()
+    return decision
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+    "reflect"
+    "testing"
+
+    "github.com/elham-abdu/cyberbullyprevention/policy"
+)
+
+// useDefaultPolicy activates the built-in policy from policy/default.json
+func useDefaultPolicy(t *testing.T) {
+    t.Helper()
+    p, err := policy.Compile(0, policy.DefaultRules())
+    if err != nil {
+        t.Fatalf("default policy does not compile: %v", err)
+    }
+    policy.SetActive(p)
+}
+
+// scored builds a result with an overall score, a severity and category
+// scores, all on the 0-100 scale providers use
+func scored(score float64, severity string, categories map[string]float64, detections ...Detection) *ToxicityResult {
+    result := &ToxicityResult{Score: score, Severity: severity, Detections: detections}
+    for name, value := range categories {
+        result.Categories = append(result.Categories, ToxicityCategory{Name: name, Score: value})
+    }
+    return result
+}
+
+func TestApplyDefaultPolicy(t *testing.T) {
+    useDefaultPolicy(t)
+
+    tests := []struct {
+        name    string
+        result  *ToxicityResult
+        signals map[string]float64
+        action  policy.Action
+        notify  bool
+        matched []string
+    }{
+        {"clean content", scored(10, "none", map[string]float64{"Insult": 10}), nil, policy.ActionAllow, false, []string{}},
+        {"toxic overall", scored(40, "medium", nil), nil, policy.ActionFlag, false, []string{"toxic overall"}},
+        {"just under toxic overall", scored(39, "low", nil), nil, policy.ActionAllow, false, []string{}},
+        {"insult", scored(30, "low", map[string]float64{"Insults": 61}), nil, policy.ActionFlag, false, []string{"insults"}},
+        {"insult at the threshold", scored(30, "low", map[string]float64{"Insults": 60}), nil, policy.ActionAllow, false, []string{}},
+        {"insult against a repeated target", scored(30, "low", map[string]float64{"insult": 45}), map[string]float64{"repeated_target": 1}, policy.ActionFlag, false, []string{"insults against a repeated target"}},
+        {"insult against someone new", scored(30, "low", map[string]float64{"insult": 45}), map[string]float64{"repeated_target": 0}, policy.ActionAllow, false, []string{}},
+        {"identity hate", scored(30, "low", map[string]float64{"Hate Speech": 50}), nil, policy.ActionFlag, false, []string{"identity hate"}},
+        {"obscene language", scored(30, "low", map[string]float64{"Profanity": 60}), nil, policy.ActionFlag, false, []string{"obscene language"}},
+        {"targeted harassment", scored(10, "none", nil), map[string]float64{"targeted_harassment": 1}, policy.ActionFlag, true, []string{"targeted harassment"}},
+        {"moderator blocked term", scored(10, "none", nil, Detection{Source: "lexicon:custom"}), nil, policy.ActionFlag, false, []string{"moderator blocked terms"}},
+        {"core lexicon term alone", scored(10, "none", nil, Detection{Source: "lexicon:core"}), nil, policy.ActionAllow, false, []string{}},
+        {"threat", scored(30, "low", map[string]float64{"Threats": 50}), nil, policy.ActionHold, true, []string{"threats"}},
+        {"critical severity", scored(30, "critical", nil), nil, policy.ActionHold, true, []string{"critical severity"}},
+        {"severe toxicity", scored(30, "low", map[string]float64{"severe_toxic": 81}), nil, policy.ActionReject, true, []string{"severe toxicity"}},
+        {
+            "strictest of several rules wins",
+            scored(90, "high", map[string]float64{"severe_toxicity": 90, "threat": 70, "insult": 70}),
+            nil, policy.ActionReject, true,
+            []string{"severe toxicity", "threats", "insults", "toxic overall"},
+        },
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            decision := ApplyPolicy(test.result, test.signals)
+            if decision.Action != test.action {
+                t.Errorf("action = %q, want %q", decision.Action, test.action)
+            }
+            if decision.Notify != test.notify {
+                t.Errorf("notify = %v, want %v", decision.Notify, test.notify)
+            }
+            if !reflect.DeepEqual(decision.Matched, test.matched) {
+                t.Errorf("matched = %q, want %q", decision.Matched, test.matched)
+            }
+            if test.result.IsFlagged != (test.action != policy.ActionAllow) {
+                t.Errorf("IsFlagged = %v for action %q", test.result.IsFlagged, test.action)
+            }
+            if test.result.Policy == nil || test.result.Policy.Action != decision.Action {
+                t.Errorf("decision not recorded on the result: %+v", test.result.Policy)
+            }
+        })
+    }
+}
+
+func TestPolicyRuleOrder(t *testing.T) {
+    rules := []policy.Rule{
+        {Name: "hold threats", When: "threat >= 0.5", Action: policy.ActionHold},
+        {Name: "flag anything", When: "score > 0", Action: policy.ActionFlag},
+        {Name: "allow quiet", When: "severity <= low", Action: policy.ActionAllow},
+    }
+    p, err := policy.Compile(3, rules)
+    if err != nil {
+        t.Fatal(err)
+    }
+    policy.SetActive(p)
+    defer useDefaultPolicy(t)
+
+    // A later, more lenient rule never lowers the action
+    decision := ApplyPolicy(scored(20, "low", map[string]float64{"threat": 60}), nil)
+    if decision.Action != policy.ActionHold {
+        t.Errorf("action = %q, want %q", decision.Action, policy.ActionHold)
+    }
+    want := []string{"hold threats", "flag anything", "allow quiet"}
+    if !reflect.DeepEqual(decision.Matched, want) {
+        t.Errorf("matched = %q, want %q", decision.Matched, want)
+    }
+    if decision.PolicyVersion != 3 {
+        t.Errorf("policy version = %d, want 3", decision.PolicyVersion)
+    }
+}
+
+func TestPolicyCompile(t *testing.T) {
+    tests := []struct {
+        name  string
+        rule  policy.Rule
+        valid bool
+    }{
+        {"comparison", policy.Rule{Name: "r", When: "insult > 0.6", Action: policy.ActionFlag}, true},
+        {"severity name", policy.Rule{Name: "r", When: "severity >= critical", Action: policy.ActionHold}, true},
+        {"signal", policy.Rule{Name: "r", When: "targeted_harassment", Action: policy.ActionFlag}, true},
+        {"negated signal", policy.Rule{Name: "r", When: "not repeated_target", Action: policy.ActionFlag}, true},
+        {"conjunction", policy.Rule{Name: "r", When: "insult >= 0.4 AND repeated_target", Action: policy.ActionFlag}, true},
+        {"missing name", policy.Rule{When: "score > 0.5", Action: policy.ActionFlag}, false},
+        {"missing condition", policy.Rule{Name: "r", Action: policy.ActionFlag}, false},
+        {"unknown action", policy.Rule{Name: "r", When: "score > 0.5", Action: "ban"}, false},
+        {"unknown operator", policy.Rule{Name: "r", When: "score => 0.5", Action: policy.ActionFlag}, false},
+        {"unknown value", policy.Rule{Name: "r", When: "severity >= extreme", Action: policy.ActionFlag}, false},
+        {"or is not supported", policy.Rule{Name: "r", When: "insult > 0.5 or threat > 0.5", Action: policy.ActionFlag}, false},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            _, err := policy.Compile(1, []policy.Rule{test.rule})
+            if (err == nil) != test.valid {
+                t.Errorf("Compile(%+v) error = %v, want valid %v", test.rule, err, test.valid)
+            }
+        })
+    }
+
+    if _, err := policy.Compile(1, nil); err == nil {
+        t.Error("Compile accepted a policy without rules")
+    }
+}
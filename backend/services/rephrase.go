@@ -0,0 +1,151 @@
+package services
+
+import (
+    "regexp"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+
+    "github.com/elham-abdu/cyberbullyprevention/lexicon"
+)
+
+// maxRephrasings is how many alternative wordings are offered at most
+const maxRephrasings = 3
+
+// Rephrasing is a softer version of the content with the offending spans
+// replaced or left out
+type Rephrasing struct {
+    Text    string           `json:"text"`
+    Changes []RephraseChange `json:"changes"`
+}
+
+// RephraseChange is one replaced span. Start and End are character offsets
+// into the original content.
+type RephraseChange struct {
+    Start       int    `json:"start"`
+    End         int    `json:"end"`
+    Original    string `json:"original"`
+    Replacement string `json:"replacement"`
+}
+
+// nudges are short explanations shown next to the rephrasings, per category
+var nudges = map[string]string{
+    CategoryInsult:         "Name-calling tends to end conversations. Try saying what you disagree with instead.",
+    CategoryThreat:         "This reads as a threat, even if you meant it as a joke.",
+    CategoryObscene:        "Some of these words may come across as aggressive.",
+    CategoryIdentityHate:   "Comments about who someone is, rather than what they said, hurt the most.",
+    CategorySevereToxicity: "This is likely to hurt someone. Please take a moment before posting.",
+    CategoryToxicity:       "This may come across as hurtful. Would you like to rephrase it?",
+}
+
+// Nudges returns one explanation per detected category, in order of first
+// appearance in the content
+func Nudges(result *ToxicityResult) []string {
+    out := []string{}
+    seen := map[string]bool{}
+    for _, detection := range result.Detections {
+        category := CanonicalCategory(detection.Category)
+        nudge, ok := nudges[category]
+        if !ok || seen[category] {
+            continue
+        }
+        seen[category] = true
+        out = append(out, nudge)
+    }
+    if len(out) == 0 && result.IsFlagged {
+        out = append(out, nudges[CategoryToxicity])
+    }
+    return out
+}
+
+// SuggestRephrasings builds softer versions of content from the detections
+// of result. Spans with lexicon alternatives are replaced by them, other
+// spans are left out. Each rephrasing uses the next alternative of every
+// term, so the first one is the lexicon's preferred wording.
+func SuggestRephrasings(content string, result *ToxicityResult) []Rephrasing {
+    spans := nonOverlapping(result.Detections)
+    if len(spans) == 0 {
+        return []Rephrasing{}
+    }
+
+    lex := lexicon.Active()
+    runes := []rune(content)
+    rephrasings := []Rephrasing{}
+    seen := map[string]bool{content: true}
+
+    for variant := 0; variant < maxRephrasings; variant++ {
+        var b strings.Builder
+        changes := []RephraseChange{}
+        last := 0
+
+        for _, span := range spans {
+            if span.Start < last || span.End > len(runes) {
+                continue
+            }
+            original := string(runes[span.Start:span.End])
+
+            replacement := ""
+            if alternatives := lex.Alternatives(span.Rule); len(alternatives) > 0 {
+                replacement = alternatives[min(variant, len(alternatives)-1)]
+            }
+            replacement = matchCase(original, replacement)
+
+            b.WriteString(string(runes[last:span.Start]))
+            b.WriteString(replacement)
+            last = span.End
+            changes = append(changes, RephraseChange{
+                Start:       span.Start,
+                End:         span.End,
+                Original:    original,
+                Replacement: replacement,
+            })
+        }
+        b.WriteString(string(runes[last:]))
+
+        text := tidySpacing(b.String())
+        if text == "" || seen[text] {
+            continue
+        }
+        seen[text] = true
+        rephrasings = append(rephrasings, Rephrasing{Text: text, Changes: changes})
+    }
+    return rephrasings
+}
+
+// nonOverlapping keeps the first, longest detection wherever detections
+// overlap. Detections must be sorted by position.
+func nonOverlapping(detections []Detection) []Detection {
+    out := []Detection{}
+    end := -1
+    for _, detection := range detections {
+        if detection.Start < end {
+            continue
+        }
+        out = append(out, detection)
+        end = detection.End
+    }
+    return out
+}
+
+// matchCase capitalizes replacement when original starts with a capital
+func matchCase(original, replacement string) string {
+    first, _ := utf8.DecodeRuneInString(original)
+    if replacement == "" || !unicode.IsUpper(first) {
+        return replacement
+    }
+    r, size := utf8.DecodeRuneInString(replacement)
+    return string(unicode.ToUpper(r)) + replacement[size:]
+}
+
+var (
+    repeatedSpaces   = regexp.MustCompile(`[ \t]{2,}`)
+    spaceBeforePunct = regexp.MustCompile(`[ \t]+([,.!?;:])`)
+)
+
+// tidySpacing collapses the double spaces and the space before punctuation
+// left behind by removed words
+func tidySpacing(text string) string {
+    text = repeatedSpaces.ReplaceAllString(text, " ")
+    text = spaceBeforePunct.ReplaceAllString(text, "$1")
+    return strings.TrimSpace(text)
+}
@@ -0,0 +1,361 @@
+package services
+
+import (
+    "fmt"
+    "log"
+    "math"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/elham-abdu/cyberbullyprevention/config"
+)
+
+// VotingRule decides how the provider scores are combined into one. The
+// ensemble never flags content itself; the moderation policy does that from
+// the combined scores.
+type VotingRule string
+
+const (
+    // VoteAnyFlag takes the highest score of any provider, so a policy rule
+    // fires when it would for any one of them
+    VoteAnyFlag VotingRule = "any_flag"
+    // VoteMajority takes the median score, so a policy rule fires when it
+    // would for most responding providers
+    VoteMajority VotingRule = "majority"
+    // VoteWeightedMean takes the mean score, weighted by provider weight
+    VoteWeightedMean VotingRule = "weighted_mean"
+)
+
+// EnsembleMember is one provider taking part in the ensemble
+type EnsembleMember struct {
+    Name    string
+    Service ToxicityService
+    // Weight is 1 when not set; a weight of 0 leaves the member out of
+    // weighted means
+    Weight  *float64
+    Timeout time.Duration
+}
+
+// weight returns the member weight, 1 when it is not set
+func (m EnsembleMember) weight() float64 {
+    if m.Weight == nil {
+        return 1
+    }
+    return *m.Weight
+}
+
+// EnsembleVote is the answer of a single provider
+type EnsembleVote struct {
+    Provider   string             `json:"provider"`
+    Weight     float64            `json:"weight"`
+    Responded  bool               `json:"responded"`
+    Error      string             `json:"error,omitempty"`
+    Score      float64            `json:"score"`
+    Severity   string             `json:"severity,omitempty"`
+    Categories map[string]float64 `json:"categories,omitempty"`
+}
+
+// EnsembleDetails records how the ensemble reached its result
+type EnsembleDetails struct {
+    Voting    VotingRule     `json:"voting"`
+    Responded []string       `json:"responded"`
+    Votes     []EnsembleVote `json:"votes"`
+    // Disagreement is the standard deviation of the provider scores (0-100)
+    Disagreement float64 `json:"disagreement"`
+}
+
+// EnsembleAnalyzer runs several providers concurrently and merges their results
+type EnsembleAnalyzer struct {
+    members []EnsembleMember
+    voting  VotingRule
+}
+
+// NewEnsembleAnalyzer creates an ensemble
+func NewEnsembleAnalyzer(voting VotingRule, members ...EnsembleMember) *EnsembleAnalyzer {
+    return &EnsembleAnalyzer{
+        members: members,
+        voting:  voting,
+    }
+}
+
+// Analyze implements ToxicityService
+func (e *EnsembleAnalyzer) Analyze(content string) (*ToxicityResult, error) {
+    return e.analyze(content, nil)
+}
+
+// AnalyzeWithContext implements ContextAnalyzer by handing the context to
+// every member that can use it
+func (e *EnsembleAnalyzer) AnalyzeWithContext(content string, context AnalysisContext) (*ToxicityResult, error) {
+    return e.analyze(content, &context)
+}
+
+// analyze runs every member at once and merges their results
+func (e *EnsembleAnalyzer) analyze(content string, context *AnalysisContext) (*ToxicityResult, error) {
+    results := make([]*ToxicityResult, len(e.members))
+    errs := make([]error, len(e.members))
+
+    var wg sync.WaitGroup
+    for i, member := range e.members {
+        wg.Add(1)
+        go func(i int, member EnsembleMember) {
+            defer wg.Done()
+            results[i], errs[i] = runProvider(PipelineProvider{
+                Name:    member.Name,
+                Service: member.Service,
+                Timeout: member.Timeout,
+            }, content, context)
+        }(i, member)
+    }
+    wg.Wait()
+
+    votes := make([]EnsembleVote, len(e.members))
+    answered := 0
+    for i, member := range e.members {
+        votes[i] = EnsembleVote{Provider: member.Name, Weight: member.weight()}
+        if errs[i] != nil {
+            votes[i].Error = errs[i].Error()
+            log.Printf("Ensemble member %s failed: %v", member.Name, errs[i])
+            continue
+        }
+
+        answered++
+        votes[i].Responded = true
+        votes[i].Score = results[i].Score
+        votes[i].Severity = results[i].Severity
+        votes[i].Categories = map[string]float64{}
+        for _, category := range results[i].Categories {
+            key := CanonicalCategory(category.Name)
+            votes[i].Categories[key] = math.Max(votes[i].Categories[key], category.Score)
+        }
+    }
+
+    if answered == 0 {
+        return nil, fmt.Errorf("no ensemble member answered")
+    }
+
+    return e.merge(results, votes), nil
+}
+
+// merge combines the member results according to the voting rule
+func (e *EnsembleAnalyzer) merge(results []*ToxicityResult, votes []EnsembleVote) *ToxicityResult {
+    merged := &ToxicityResult{
+        Categories:  []ToxicityCategory{},
+        ToxicWords:  []string{},
+        Detections:  []Detection{},
+        Suggestions: []string{},
+    }
+    details := &EnsembleDetails{Voting: e.voting, Responded: []string{}, Votes: votes}
+
+    scores := []weightedScore{}
+    confidences := []weightedScore{}
+    severities := []weightedScore{}
+    categoryScores := map[string][]weightedScore{}
+    categoryDetected := map[string][]weightedScore{}
+    topWeight := -1.0
+    seenWords := map[string]bool{}
+    seenSuggestions := map[string]bool{}
+
+    for i, vote := range votes {
+        if !vote.Responded {
+            continue
+        }
+        result := results[i]
+        weight := vote.Weight
+
+        details.Responded = append(details.Responded, vote.Provider)
+        scores = append(scores, weightedScore{result.Score, weight})
+        confidences = append(confidences, weightedScore{result.Confidence, weight})
+        severities = append(severities, weightedScore{float64(severityRank[result.Severity]), weight})
+
+        for _, category := range result.Categories {
+            key := CanonicalCategory(category.Name)
+            categoryScores[key] = append(categoryScores[key], weightedScore{category.Score, weight})
+            detected := 0.0
+            if category.Detected {
+                detected = 100
+            }
+            categoryDetected[key] = append(categoryDetected[key], weightedScore{detected, weight})
+        }
+
+        for _, word := range result.ToxicWords {
+            if !seenWords[word] {
+                seenWords[word] = true
+                merged.ToxicWords = append(merged.ToxicWords, word)
+            }
+        }
+        // Every member's detections are kept; the pipeline drops duplicates
+        merged.Detections = append(merged.Detections, result.Detections...)
+        for _, suggestion := range result.Suggestions {
+            if !seenSuggestions[suggestion] {
+                seenSuggestions[suggestion] = true
+                merged.Suggestions = append(merged.Suggestions, suggestion)
+            }
+        }
+
+        // Sentiment and context come from the most trusted provider that
+        // answered
+        if weight > topWeight {
+            topWeight = weight
+            merged.Sentiment = result.Sentiment
+            merged.Context = result.Context
+        }
+    }
+
+    merged.Score = e.combine(scores)
+    merged.Confidence = weightedMean(confidences)
+    merged.Severity = severityAt(math.Round(e.combine(severities)))
+
+    keys := make([]string, 0, len(categoryScores))
+    for key := range categoryScores {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+
+    for _, key := range keys {
+        info, ok := categoryInfo[key]
+        if !ok {
+            info = ToxicityCategory{Name: key}
+        }
+        merged.Categories = append(merged.Categories, ToxicityCategory{
+            Name:        info.Name,
+            Score:       e.combine(categoryScores[key]),
+            Detected:    e.combine(categoryDetected[key]) > 50,
+            Description: info.Description,
+        })
+    }
+
+    // Disagreement between providers
+    variance := 0.0
+    for _, score := range scores {
+        variance += (score.value - merged.Score) * (score.value - merged.Score)
+    }
+    details.Disagreement = math.Sqrt(variance / float64(len(scores)))
+
+    // Providers that disagree lower our confidence in the merged result
+    merged.Confidence *= 1 - math.Min(details.Disagreement/100, 0.5)
+
+    merged.Ensemble = details
+    return merged
+}
+
+// weightedScore is one member's value for a score, with the member weight
+type weightedScore struct {
+    value  float64
+    weight float64
+}
+
+// combine merges the members' values for one score by the voting rule
+func (e *EnsembleAnalyzer) combine(scores []weightedScore) float64 {
+    if len(scores) == 0 {
+        return 0
+    }
+    switch e.voting {
+    case VoteMajority:
+        values := make([]float64, len(scores))
+        for i, score := range scores {
+            values[i] = score.value
+        }
+        sort.Float64s(values)
+        middle := len(values) / 2
+        if len(values)%2 == 0 {
+            return (values[middle-1] + values[middle]) / 2
+        }
+        return values[middle]
+    case VoteWeightedMean:
+        return weightedMean(scores)
+    default:
+        highest := scores[0].value
+        for _, score := range scores[1:] {
+            highest = math.Max(highest, score.value)
+        }
+        return highest
+    }
+}
+
+// weightedMean is the mean of the values, weighted by member weight
+func weightedMean(scores []weightedScore) float64 {
+    total, weights := 0.0, 0.0
+    for _, score := range scores {
+        total += score.value * score.weight
+        weights += score.weight
+    }
+    if weights == 0 {
+        return 0
+    }
+    return total / weights
+}
+
+// severityAt returns the severity label of a rank
+func severityAt(rank float64) string {
+    for name, r := range severityRank {
+        if float64(r) == rank {
+            return name
+        }
+    }
+    return "none"
+}
+
+// Version implements VersionedService and lists the member versions
+func (e *EnsembleAnalyzer) Version() string {
+    versions := make([]string, 0, len(e.members))
+    for _, member := range e.members {
+        version := member.Name
+        if versioned, ok := member.Service.(VersionedService); ok {
+            version += "@" + versioned.Version()
+        }
+        versions = append(versions, version)
+    }
+    return "ensemble(" + strings.Join(versions, ",") + ")"
+}
+
+// NewEnsembleFromEnv builds the ensemble from environment variables.
+//
+// TOXICITY_ENSEMBLE_MEMBERS lists the providers (default "ibm,ml,rules"),
+// TOXICITY_ENSEMBLE_WEIGHTS sets weights as "ibm=0.5,ml=0.3,rules=0.2"
+// (members without one weigh 1, negative weights are ignored),
+// TOXICITY_ENSEMBLE_VOTING is "any_flag", "majority" or "weighted_mean".
+func NewEnsembleFromEnv() *EnsembleAnalyzer {
+    weights := map[string]float64{"ibm": 0.5, "ml": 0.3, "rules": 0.2}
+    for _, pair := range strings.Split(config.GetEnvOrDefault("TOXICITY_ENSEMBLE_WEIGHTS", ""), ",") {
+        parts := strings.SplitN(pair, "=", 2)
+        if len(parts) != 2 {
+            continue
+        }
+        weight, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+        if err != nil || weight < 0 {
+            log.Printf("Invalid ensemble weight %q, ignoring", pair)
+            continue
+        }
+        weights[strings.ToLower(strings.TrimSpace(parts[0]))] = weight
+    }
+
+    voting := VotingRule(strings.ToLower(config.GetEnvOrDefault("TOXICITY_ENSEMBLE_VOTING", string(VoteAnyFlag))))
+    if voting != VoteAnyFlag && voting != VoteMajority && voting != VoteWeightedMean {
+        log.Printf("Unknown ensemble voting rule %q, using %q", voting, VoteAnyFlag)
+        voting = VoteAnyFlag
+    }
+
+    members := []EnsembleMember{}
+    for _, name := range strings.Split(config.GetEnvOrDefault("TOXICITY_ENSEMBLE_MEMBERS", "ibm,ml,rules"), ",") {
+        name = strings.ToLower(strings.TrimSpace(name))
+        defaults, ok := providerDefaults[name]
+        if !ok {
+            log.Printf("Unknown ensemble member %q, skipping", name)
+            continue
+        }
+        member := EnsembleMember{
+            Name:    name,
+            Service: defaults.service(),
+            Timeout: defaults.timeout,
+        }
+        if weight, ok := weights[name]; ok {
+            member.Weight = &weight
+        }
+        members = append(members, member)
+    }
+
+    return NewEnsembleAnalyzer(voting, members...)
+}
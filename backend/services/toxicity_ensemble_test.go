@@ -0,0 +1,40 @@
+package services
+
+import "testing"
+
+// fixedModel gives every content the same score
+type fixedModel float64
+
+func (m fixedModel) Analyze(content string) (*ToxicityResult, error) {
+    return &ToxicityResult{Score: float64(m), Severity: "none"}, nil
+}
+
+func TestEnsembleWeights(t *testing.T) {
+    zero, three := 0.0, 3.0
+
+    tests := []struct {
+        name    string
+        weights []*float64
+        score   float64
+    }{
+        {"unset weights count the same", []*float64{nil, nil}, 60},
+        {"set weights are honoured", []*float64{&three, nil}, 80},
+        {"a zero weight leaves the member out", []*float64{&zero, nil}, 20},
+        {"only zero weights score nothing", []*float64{&zero, &zero}, 0},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            ensemble := NewEnsembleAnalyzer(VoteWeightedMean,
+                EnsembleMember{Name: "high", Service: fixedModel(100), Weight: test.weights[0]},
+                EnsembleMember{Name: "low", Service: fixedModel(20), Weight: test.weights[1]},
+            )
+            result, err := ensemble.Analyze("hello")
+            if err != nil {
+                t.Fatal(err)
+            }
+            if result.Score != test.score {
+                t.Errorf("score = %v, want %v", result.Score, test.score)
+            }
+        })
+    }
+}
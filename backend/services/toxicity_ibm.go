@@ -99,8 +99,9 @@ func (i *IBMAnalyzer) convertToResult(toxic, severeToxic, obscene, threat, insul
     
     result := &ToxicityResult{
         Score:       toxic * 100,
-        IsFlagged:   toxic > 0.5 || threat > 0.5,
         ToxicWords:  []string{},
+        // The MAX classifier scores whole comments, it has no token attributions
+        Detections:  []Detection{},
         Suggestions: []string{},
         Categories:  []ToxicityCategory{},
     }
@@ -179,31 +180,37 @@ func (i *IBMAnalyzer) convertToResult(toxic, severeToxic, obscene, threat, insul
         result.Sentiment = "negative"
     }
 
-    // Add suggestions if content is flagged
-    if result.IsFlagged {
-        if threat > 0.5 {
-            result.Suggestions = append(result.Suggestions,
-                "⚠️ Threatening content detected. This violates our safety policy.")
-        }
-        if identityHate > 0.5 {
-            result.Suggestions = append(result.Suggestions,
-                "⚠️ Hate speech based on identity is strictly prohibited.")
-        }
-        if insult > 0.5 {
-            result.Suggestions = append(result.Suggestions,
-                "⚠️ Insulting language detected. Please communicate respectfully.")
-        }
-        if obscene > 0.5 {
-            result.Suggestions = append(result.Suggestions,
-                "⚠️ Obscene language is not allowed.")
-        }
+    // Add suggestions for the categories the model detected
+    if threat > 0.5 {
         result.Suggestions = append(result.Suggestions,
-            "This content has been flagged for review.")
+            "⚠️ Threatening content detected. This violates our safety policy.")
+    }
+    if identityHate > 0.5 {
+        result.Suggestions = append(result.Suggestions,
+            "⚠️ Hate speech based on identity is strictly prohibited.")
+    }
+    if insult > 0.5 {
+        result.Suggestions = append(result.Suggestions,
+            "⚠️ Insulting language detected. Please communicate respectfully.")
+    }
+    if obscene > 0.5 {
+        result.Suggestions = append(result.Suggestions,
+            "⚠️ Obscene language is not allowed.")
     }
 
     return result
 }
 
+// AnalyzeWithContext implements ContextAnalyzer
+func (i *IBMAnalyzer) AnalyzeWithContext(content string, context AnalysisContext) (*ToxicityResult, error) {
+    return analyzeInContext(i, content, context)
+}
+
+// Version implements VersionedService
+func (i *IBMAnalyzer) Version() string {
+    return "max-toxic-comment-classifier"
+}
+
 // CheckHealth checks if IBM service is available
 func (i *IBMAnalyzer) CheckHealth() error {
     resp, err := i.client.Get("http://localhost:5000/model/predict")
@@ -217,8 +224,3 @@ func (i *IBMAnalyzer) CheckHealth() error {
 
 // Global IBM analyzer instance
 var GlobalIBMAnalyzer = NewIBMAnalyzer()
-
-// AnalyzeToxicityWithIBM is the main export function
-func AnalyzeToxicityWithIBM(content string) (*ToxicityResult, error) {
-    return GlobalIBMAnalyzer.Analyze(content)
-}
@@ -1,7 +1,14 @@
 ﻿package services
 
 import (
+    "fmt"
+    "math"
     "strings"
+
+    "github.com/elham-abdu/cyberbullyprevention/lexicon"
+    "github.com/elham-abdu/cyberbullyprevention/matcher"
+    "github.com/elham-abdu/cyberbullyprevention/normalize"
+    "github.com/elham-abdu/cyberbullyprevention/policy"
 )
 
 // ToxicityResult contains detailed analysis results
@@ -11,9 +18,26 @@ type ToxicityResult struct {
     Severity    string            `json:"severity"`
     Categories  []ToxicityCategory `json:"categories"`
     ToxicWords  []string          `json:"toxic_words"`
+    Detections  []Detection       `json:"detections"`
     Sentiment   string            `json:"sentiment"`
     Confidence  float64           `json:"confidence"`
     Suggestions []string          `json:"suggestions"`
+
+    // Filled in by AnalyzerPipeline
+    Policy          *policy.Decision  `json:"policy,omitempty"`
+    Provider        string            `json:"provider"`
+    ProviderVersion string            `json:"provider_version"`
+    FallbackUsed    bool              `json:"fallback_used"`
+    LatencyMs       int64             `json:"latency_ms"`
+    Attempts        []ProviderAttempt `json:"attempts,omitempty"`
+    Normalized      string            `json:"normalized,omitempty"`
+    LexiconVersion  string            `json:"lexicon_version"`
+
+    // Filled in by EnsembleAnalyzer
+    Ensemble *EnsembleDetails `json:"ensemble,omitempty"`
+
+    // Filled in by context-aware analysis
+    Context *ContextDetails `json:"context,omitempty"`
 }
 
 // ToxicityCategory represents different types of toxic content
@@ -24,23 +48,38 @@ type ToxicityCategory struct {
     Description string  `json:"description"`
 }
 
+// Detection is one offending span of the content. Analyzers report Start
+// and End as byte offsets into the text they were given; the pipeline turns
+// them into character offsets into the original content.
+type Detection struct {
+    Start    int     `json:"start"`
+    End      int     `json:"end"`
+    Text     string  `json:"text"`
+    Category string  `json:"category"`
+    // Source is the lexicon or model that fired, e.g. "lexicon:core"
+    Source string `json:"source"`
+    // Rule is the lexicon term that matched, empty for model attributions
+    Rule  string  `json:"rule,omitempty"`
+    Score float64 `json:"score"`
+}
+
 // ToxicityService defines the interface for toxicity analysis
 type ToxicityService interface {
     Analyze(content string) (*ToxicityResult, error)
 }
 
-// GetToxicityService returns the appropriate toxicity service
+// VersionedService is implemented by providers that can report which
+// model or rule set produced a result
+type VersionedService interface {
+    Version() string
+}
+
+// GetToxicityService returns the configured analyzer pipeline
 func GetToxicityService() ToxicityService {
-    // Create a new IBM analyzer to check health
-    ibmAnalyzer := NewIBMAnalyzer()
-    
-    // Try IBM first
-    if err := ibmAnalyzer.CheckHealth(); err == nil {
-        return GlobalIBMAnalyzer
+    if GlobalPipeline == nil {
+        InitPipeline()
     }
-    
-    // Fallback to rule-based if IBM not available
-    return NewRuleBasedAnalyzer()
+    return GlobalPipeline
 }
 
 // RuleBasedAnalyzer as fallback
@@ -55,75 +94,103 @@ func (r *RuleBasedAnalyzer) Analyze(content string) (*ToxicityResult, error) {
     return analyzeWithRules(content), nil
 }
 
-// analyzeWithRules provides rule-based fallback
+// AnalyzeWithContext implements ContextAnalyzer
+func (r *RuleBasedAnalyzer) AnalyzeWithContext(content string, context AnalysisContext) (*ToxicityResult, error) {
+    return analyzeInContext(r, content, context)
+}
+
+// Version implements VersionedService
+func (r *RuleBasedAnalyzer) Version() string {
+    return "rules-2"
+}
+
+// wordListEntries turns category word lists into matcher entries
+func wordListEntries(lists map[string][]string) []matcher.Entry {
+    entries := []matcher.Entry{}
+    for category, words := range lists {
+        for _, word := range words {
+            entries = append(entries, matcher.Entry{Term: word, Category: category, Weight: 1})
+        }
+    }
+    return entries
+}
+
+// countMatches adds matched words and detections to the result and returns
+// the weighted number of matches per canonical category, along with the
+// highest entry severity. A word matched by several terms of the same category only
+// counts once.
+func countMatches(matches []matcher.Match, result *ToxicityResult) (map[string]float64, string) {
+    counts := map[string]float64{}
+    severity := "none"
+    seen := map[string]bool{}
+    for _, match := range matches {
+        category := CanonicalCategory(match.Category)
+        key := fmt.Sprintf("%s:%d", category, match.Start)
+        if seen[key] {
+            continue
+        }
+        seen[key] = true
+        counts[category] += match.Weight
+        if match.Severity != "" {
+            severity = maxSeverity(severity, match.Severity)
+        }
+        result.ToxicWords = append(result.ToxicWords, match.Text)
+        result.Detections = append(result.Detections, matchDetection(match))
+    }
+    return counts, severity
+}
+
+// findTerms looks the terms of m up in the normalized text and reports each
+// match at the byte range of the original text it came from. The matched
+// text keeps its normalized spelling, the way the lexicon has it.
+func findTerms(m *matcher.Matcher, normalized normalize.Result) []matcher.Match {
+    matches := m.Find(normalized.Text)
+    for i := range matches {
+        matches[i].Start, matches[i].End = normalized.OriginalRange(matches[i].Start, matches[i].End)
+    }
+    return matches
+}
+
+// matchDetection turns a lexicon match into a detection
+func matchDetection(match matcher.Match) Detection {
+    return Detection{
+        Start:    match.Start,
+        End:      match.End,
+        Text:     match.Text,
+        Category: CanonicalCategory(match.Category),
+        Source:   match.Source,
+        Rule:     match.Term,
+        Score:    math.Min(100, 20*match.Weight),
+    }
+}
+
+// analyzeWithRules provides rule-based fallback. It matches the lexicon
+// against the normalized content, so "5tup1d" is caught, and reports
+// detections at their place in content.
 func analyzeWithRules(content string) *ToxicityResult {
     result := &ToxicityResult{
         Categories:  []ToxicityCategory{},
         ToxicWords:  []string{},
+        Detections:  []Detection{},
         Suggestions: []string{},
     }
 
     text := strings.ToLower(content)
-    words := strings.Fields(text)
-
-    // Define word lists
-    profanityList := []string{"fuck", "shit", "damn", "hell", "ass", "bitch"}
-    insultList := []string{"stupid", "idiot", "dumb", "moron", "loser", "dummy"}
-    threatList := []string{"kill", "die", "hurt", "attack", "destroy", "beat"}
-    hateSpeechList := []string{"hate", "racist", "sexist", "nazi", "discriminate"}
-
-    // Count occurrences in words
-    profanityCount := 0
-    insultCount := 0
-    threatCount := 0
-    hateCount := 0
-
-    // Check each word individually
-    for _, word := range words {
-        wordLower := strings.ToLower(word)
-        
-        // Check profanity
-        for _, badWord := range profanityList {
-            if strings.Contains(wordLower, badWord) {
-                profanityCount++
-                result.ToxicWords = append(result.ToxicWords, word)
-                break
-            }
-        }
-        
-        // Check insults
-        for _, badWord := range insultList {
-            if strings.Contains(wordLower, badWord) {
-                insultCount++
-                result.ToxicWords = append(result.ToxicWords, word)
-                break
-            }
-        }
-        
-        // Check threats
-        for _, badWord := range threatList {
-            if strings.Contains(wordLower, badWord) {
-                threatCount++
-                result.ToxicWords = append(result.ToxicWords, word)
-                break
-            }
-        }
-        
-        // Check hate speech
-        for _, badWord := range hateSpeechList {
-            if strings.Contains(wordLower, badWord) {
-                hateCount++
-                result.ToxicWords = append(result.ToxicWords, word)
-                break
-            }
-        }
-    }
+
+    // Count lexicon matches on word boundaries
+    lex := lexicon.Active()
+    result.LexiconVersion = lex.FullVersion()
+    counts, lexiconSeverity := countMatches(findTerms(lex.Matcher, normalize.Normalize(content)), result)
+    profanityCount := counts[CategoryObscene]
+    insultCount := counts[CategoryInsult]
+    threatCount := counts[CategoryThreat]
+    hateCount := counts[CategoryIdentityHate]
 
     // Calculate scores (0-100)
-    profanityScore := float64(profanityCount * 20)
-    insultScore := float64(insultCount * 20)
-    threatScore := float64(threatCount * 25)
-    hateScore := float64(hateCount * 30)
+    profanityScore := profanityCount * 20
+    insultScore := insultCount * 20
+    threatScore := threatCount * 25
+    hateScore := hateCount * 25
 
     // Cap at 100
     if profanityScore > 100 { profanityScore = 100 }
@@ -144,11 +211,10 @@ func analyzeWithRules(content string) *ToxicityResult {
     )
 
     // Calculate overall score
-    totalScore := (profanityScore*0.2 + insultScore*0.25 + threatScore*0.3 + hateScore*0.25)
+    totalScore := overallScore(profanityScore, insultScore, threatScore, hateScore)
 
     result.Score = totalScore
-    result.IsFlagged = totalScore >= 30
-    result.Severity = getSeverity(totalScore)
+    result.Severity = maxSeverity(getSeverity(totalScore), lexiconSeverity)
     result.Sentiment = getSentiment(text)
     result.Confidence = 0.6 + (float64(len(result.ToxicWords)) * 0.1)
     if result.Confidence > 0.95 {
@@ -158,6 +224,25 @@ func analyzeWithRules(content string) *ToxicityResult {
     return result
 }
 
+// overallScore combines category scores: the strongest category counts in
+// full and the others add a quarter of theirs, so a single serious phrase is
+// not averaged away by the categories that did not match
+func overallScore(scores ...float64) float64 {
+    strongest := 0.0
+    total := 0.0
+    for _, score := range scores {
+        strongest = math.Max(strongest, score)
+        total += score
+    }
+    return math.Min(100, strongest+(total-strongest)*0.25)
+}
+
+// sentimentMatcher finds positive and negative words for getSentiment
+var sentimentMatcher = matcher.MustCompile(wordListEntries(map[string][]string{
+    "positive": {"good", "great", "awesome", "excellent", "love", "thanks", "perfect"},
+    "negative": {"bad", "hate", "awful", "terrible", "worst", "horrible"},
+}), nil)
+
 // Helper functions
 func getSeverity(score float64) string {
     switch {
@@ -173,20 +258,13 @@ func getSeverity(score float64) string {
 }
 
 func getSentiment(text string) string {
-    positiveWords := []string{"good", "great", "awesome", "excellent", "love", "thanks", "perfect"}
-    negativeWords := []string{"bad", "hate", "awful", "terrible", "worst", "horrible"}
-
     posCount := 0
     negCount := 0
 
-    for _, word := range positiveWords {
-        if strings.Contains(text, word) {
+    for _, match := range sentimentMatcher.Find(text) {
+        if match.Category == "positive" {
             posCount++
-        }
-    }
-
-    for _, word := range negativeWords {
-        if strings.Contains(text, word) {
+        } else {
             negCount++
         }
     }
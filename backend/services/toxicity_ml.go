@@ -3,10 +3,8 @@
 import (
     "bytes"
     "encoding/json"
-    "log"
+    "fmt"
     "net/http"
-    "strings"
-    "regexp"
 )
 
 // MLToxicityAnalyzer uses ML models for toxicity detection
@@ -26,6 +24,17 @@ type MLPrediction struct {
     SentimentScore    float64            `json:"sentiment_score"`
     Confidence        float64            `json:"confidence"`
     Categories        map[string]float64 `json:"categories"`
+    Attributions      []MLAttribution    `json:"attributions"`
+}
+
+// MLAttribution is how much a single token contributed to the toxicity
+// score. Start and End are character offsets into the text sent to the model.
+type MLAttribution struct {
+    Token    string  `json:"token"`
+    Start    int     `json:"start"`
+    End      int     `json:"end"`
+    Score    float64 `json:"score"`
+    Category string  `json:"category"`
 }
 
 // REMOVED: ToxicityResult and ToxicityCategory type definitions
@@ -39,17 +48,24 @@ func NewMLToxicityAnalyzer() *MLToxicityAnalyzer {
     }
 }
 
-// AnalyzeWithML performs ML-based toxicity analysis
-func (m *MLToxicityAnalyzer) AnalyzeWithML(content string) (*ToxicityResult, error) {
-    // Try ML model first
+// Analyze implements ToxicityService using only the ML model, so the
+// pipeline can decide what to fall back to
+func (m *MLToxicityAnalyzer) Analyze(content string) (*ToxicityResult, error) {
     mlResult, err := m.callMLModel(content)
-    if err == nil && mlResult != nil {
-        return m.convertMLResult(mlResult, content), nil
+    if err != nil {
+        return nil, fmt.Errorf("ML model unavailable: %v", err)
     }
+    return m.convertMLResult(mlResult, content), nil
+}
+
+// AnalyzeWithContext implements ContextAnalyzer
+func (m *MLToxicityAnalyzer) AnalyzeWithContext(content string, context AnalysisContext) (*ToxicityResult, error) {
+    return analyzeInContext(m, content, context)
+}
 
-    // Fallback to rule-based if ML fails
-    log.Printf("ML model unavailable, falling back to rule-based: %v", err)
-    return m.analyzeWithRules(content), nil
+// Version implements VersionedService
+func (m *MLToxicityAnalyzer) Version() string {
+    return "ml-service/unitary-toxic-bert"
 }
 
 // callMLModel calls an external ML model service
@@ -69,6 +85,10 @@ func (m *MLToxicityAnalyzer) callMLModel(content string) (*MLPrediction, error)
     }
     defer resp.Body.Close()
 
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("ML model returned error status: %d", resp.StatusCode)
+    }
+
     var prediction MLPrediction
     err = json.NewDecoder(resp.Body).Decode(&prediction)
     if err != nil {
@@ -78,250 +98,14 @@ func (m *MLToxicityAnalyzer) callMLModel(content string) (*MLPrediction, error)
     return &prediction, nil
 }
 
-// analyzeWithRules provides rule-based fallback
-func (m *MLToxicityAnalyzer) analyzeWithRules(content string) *ToxicityResult {
-    result := &ToxicityResult{
-        Categories:  []ToxicityCategory{},
-        ToxicWords:  []string{},
-        Suggestions: []string{},
-    }
-
-    text := strings.ToLower(content)
-    words := strings.Fields(text)
-
-    // Define word lists
-    profanityList := []string{"fuck", "shit", "damn", "hell", "ass", "bitch"}
-    insultList := []string{"stupid", "idiot", "dumb", "moron", "loser", "dummy"}
-    threatList := []string{"kill", "die", "hurt", "attack", "destroy", "beat"}
-    hateSpeechList := []string{"hate", "racist", "sexist", "nazi", "discriminate"}
-
-    // Count occurrences in words
-    profanityCount := 0
-    insultCount := 0
-    threatCount := 0
-    hateCount := 0
-
-    // Check each word individually
-    for _, word := range words {
-        wordLower := strings.ToLower(word)
-        
-        // Check profanity
-        for _, badWord := range profanityList {
-            if strings.Contains(wordLower, badWord) {
-                profanityCount++
-                result.ToxicWords = append(result.ToxicWords, word)
-                break
-            }
-        }
-        
-        // Check insults
-        for _, badWord := range insultList {
-            if strings.Contains(wordLower, badWord) {
-                insultCount++
-                result.ToxicWords = append(result.ToxicWords, word)
-                break
-            }
-        }
-        
-        // Check threats
-        for _, badWord := range threatList {
-            if strings.Contains(wordLower, badWord) {
-                threatCount++
-                result.ToxicWords = append(result.ToxicWords, word)
-                break
-            }
-        }
-        
-        // Check hate speech
-        for _, badWord := range hateSpeechList {
-            if strings.Contains(wordLower, badWord) {
-                hateCount++
-                result.ToxicWords = append(result.ToxicWords, word)
-                break
-            }
-        }
-    }
-
-    // Also check for multi-word phrases
-    fullTextLower := strings.ToLower(content)
-    
-    // Check for phrases in threats
-    threatPhrases := []string{"kill you", "hurt you", "going to get you", "beat you up"}
-    for _, phrase := range threatPhrases {
-        if strings.Contains(fullTextLower, phrase) {
-            threatCount += 2
-            result.ToxicWords = append(result.ToxicWords, phrase)
-        }
-    }
-
-    // Calculate scores (0-100)
-    profanityScore := float64(profanityCount * 20)
-    insultScore := float64(insultCount * 20)
-    threatScore := float64(threatCount * 25)
-    hateScore := float64(hateCount * 30)
-
-    // Cap at 100
-    if profanityScore > 100 { profanityScore = 100 }
-    if insultScore > 100 { insultScore = 100 }
-    if threatScore > 100 { threatScore = 100 }
-    if hateScore > 100 { hateScore = 100 }
-
-    // Add categories
-    result.Categories = append(result.Categories,
-        ToxicityCategory{Name: "Profanity", Score: profanityScore, 
-            Detected: profanityCount > 0, Description: "Profane language"},
-        ToxicityCategory{Name: "Insults", Score: insultScore, 
-            Detected: insultCount > 0, Description: "Insulting language"},
-        ToxicityCategory{Name: "Threats", Score: threatScore, 
-            Detected: threatCount > 0, Description: "Threatening language"},
-        ToxicityCategory{Name: "Hate Speech", Score: hateScore, 
-            Detected: hateCount > 0, Description: "Hate speech"},
-    )
-
-    // Calculate overall score
-    totalScore := (profanityScore*0.2 + insultScore*0.25 + threatScore*0.3 + hateScore*0.25)
-    
-    // Check for patterns (ALL CAPS, repetition)
-    patternScore := m.detectPatterns(content)
-    totalScore += patternScore
-
-    // Word count analysis
-    wordCount := len(words)
-    if wordCount < 3 && totalScore > 50 {
-        totalScore *= 0.8
-    }
-
-    if totalScore > 100 {
-        totalScore = 100
-    }
-
-    result.Score = totalScore
-    result.IsFlagged = totalScore >= 30
-    result.Severity = m.getSeverity(totalScore)
-    result.Sentiment = m.getSentimentFromWords(words, fullTextLower)
-    result.Confidence = 0.6 + (float64(len(result.ToxicWords)) * 0.1)
-    if result.Confidence > 0.95 {
-        result.Confidence = 0.95
-    }
-
-    // Add suggestions based on what was found
-    if result.IsFlagged {
-        if threatCount > 0 {
-            result.Suggestions = append(result.Suggestions, 
-                "Threatening content detected. This violates our safety policy.")
-        }
-        if hateCount > 0 {
-            result.Suggestions = append(result.Suggestions, 
-                "Hate speech is not tolerated on this platform.")
-        }
-        if insultCount > 2 {
-            result.Suggestions = append(result.Suggestions, 
-                "Repeated insults detected. Please be respectful.")
-        }
-        result.Suggestions = append(result.Suggestions, 
-            "Content has been flagged for review.")
-    }
-
-    return result
-}
-
-// getSentimentFromWords - more accurate sentiment analysis
-func (m *MLToxicityAnalyzer) getSentimentFromWords(words []string, fullText string) string {
-    positiveWords := []string{"good", "great", "awesome", "excellent", "love", "thanks", "perfect", "beautiful"}
-    negativeWords := []string{"bad", "hate", "awful", "terrible", "worst", "horrible", "dislike"}
-
-    posCount := 0
-    negCount := 0
-
-    // Check each word
-    for _, word := range words {
-        wordLower := strings.ToLower(word)
-        for _, pos := range positiveWords {
-            if wordLower == pos {
-                posCount++
-                break
-            }
-        }
-        for _, neg := range negativeWords {
-            if wordLower == neg {
-                negCount++
-                break
-            }
-        }
-    }
-
-    // Check for negations
-    if strings.Contains(fullText, "not good") || strings.Contains(fullText, "not great") {
-        negCount += 2
-    }
-
-    if posCount > negCount*2 {
-        return "positive"
-    } else if negCount > posCount*2 {
-        return "negative"
-    } else if posCount == 0 && negCount == 0 {
-        return "neutral"
-    } else {
-        return "mixed"
-    }
-}
-
-// detectPatterns detects suspicious patterns
-func (m *MLToxicityAnalyzer) detectPatterns(content string) float64 {
-    score := 0.0
-
-    // Check for ALL CAPS
-    capsCount := 0
-    letterCount := 0
-    for _, r := range content {
-        if (r >= 'A' && r <= 'Z') {
-            capsCount++
-            letterCount++
-        } else if (r >= 'a' && r <= 'z') {
-            letterCount++
-        }
-    }
-    if letterCount > 0 && float64(capsCount)/float64(letterCount) > 0.5 {
-        score += 10
-    }
-
-    // Check for repeated characters
-    repeatPattern := regexp.MustCompile(`(.)\1{3,}`)
-    if repeatPattern.MatchString(content) {
-        score += 10
-    }
-
-    // Check for excessive punctuation
-    punctCount := strings.Count(content, "!") + strings.Count(content, "?")
-    if punctCount > 3 {
-        score += 5
-    }
-
-    return score
-}
-
-// getSeverity determines severity level
-func (m *MLToxicityAnalyzer) getSeverity(score float64) string {
-    switch {
-    case score >= 70:
-        return "high"
-    case score >= 40:
-        return "medium"
-    case score >= 20:
-        return "low"
-    default:
-        return "none"
-    }
-}
-
 // convertMLResult converts ML model output to our result format
 func (m *MLToxicityAnalyzer) convertMLResult(ml *MLPrediction, content string) *ToxicityResult {
     result := &ToxicityResult{
         Score:       ml.ToxicityScore * 100,
-        IsFlagged:   ml.ToxicityScore > 0.4,
         Sentiment:   m.sentimentFromScore(ml.SentimentScore),
         Confidence:  ml.Confidence,
         ToxicWords:  []string{},
+        Detections:  []Detection{},
         Suggestions: []string{},
         Categories: []ToxicityCategory{
             {Name: "Severe Toxicity", Score: ml.SevereToxicity * 100, 
@@ -345,7 +129,28 @@ func (m *MLToxicityAnalyzer) convertMLResult(ml *MLPrediction, content string) *
     }
     
     result.Severity = m.determineSeverityML(result.Score, ml.Threat*100)
-    
+
+    // Token attributions become detections
+    for _, attribution := range ml.Attributions {
+        start, end, ok := runeRangeToBytes(content, attribution.Start, attribution.End)
+        if !ok {
+            continue
+        }
+        category := attribution.Category
+        if category == "" {
+            category = CategoryToxicity
+        }
+        result.Detections = append(result.Detections, Detection{
+            Start:    start,
+            End:      end,
+            Text:     content[start:end],
+            Category: CanonicalCategory(category),
+            Source:   "model:" + m.Version(),
+            Score:    attribution.Score * 100,
+        })
+        result.ToxicWords = append(result.ToxicWords, content[start:end])
+    }
+
     return result
 }
 
@@ -384,8 +189,3 @@ func (m *MLToxicityAnalyzer) sentimentFromScore(score float64) string {
 
 // Global ML analyzer instance
 var GlobalMLAnalyzer = NewMLToxicityAnalyzer()
-
-// AnalyzeToxicityML is the main export function
-func AnalyzeToxicityML(content string) (*ToxicityResult, error) {
-    return GlobalMLAnalyzer.AnalyzeWithML(content)
-}
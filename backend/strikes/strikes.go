@@ -0,0 +1,348 @@
+// Package strikes counts confirmed violations against users and applies
+// sanctions when they add up.
+//
+// Every confirmed violation adds a strike weighted by its violation reason.
+// Strikes decay with a half-life, so a user's standing is the sum of
+// weight × 0.5^(age / half-life). When a new strike pushes the standing
+// over a threshold the matching sanction starts: a warning, a posting
+// cooldown, a temporary suspension or a permanent ban. Revoking a strike,
+// e.g. after an overturned appeal, lifts the sanctions the user no longer
+// reaches.
+package strikes
+
+import (
+    "fmt"
+    "log"
+    "math"
+    "slices"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/elham-abdu/cyberbullyprevention/config"
+    "github.com/elham-abdu/cyberbullyprevention/models"
+    "github.com/elham-abdu/cyberbullyprevention/moderation"
+    "gorm.io/gorm"
+)
+
+// Kinds lists the sanction kinds from mildest to most severe
+var Kinds = []string{
+    models.SanctionWarning,
+    models.SanctionCooldown,
+    models.SanctionSuspension,
+    models.SanctionBan,
+}
+
+// rank orders sanction kinds by severity
+var rank = map[string]int{
+    models.SanctionWarning:    1,
+    models.SanctionCooldown:   2,
+    models.SanctionSuspension: 3,
+    models.SanctionBan:        4,
+}
+
+// Settings configure strike decay and escalation
+type Settings struct {
+    HalfLife time.Duration
+    // Thresholds are the standings at which each sanction starts
+    Thresholds map[string]float64
+    // Durations are how long each sanction lasts; a ban has none. A warning
+    // restricts nothing, its duration only keeps it from repeating.
+    Durations map[string]time.Duration
+}
+
+// SettingsFromEnv reads the settings from STRIKE_HALF_LIFE_DAYS (default
+// 30), STRIKE_THRESHOLDS as "warning=1,cooldown=3,suspension=6,ban=10",
+// STRIKE_COOLDOWN_HOURS (default 24) and STRIKE_SUSPENSION_DAYS (default 7)
+func SettingsFromEnv() Settings {
+    halfLifeDays := envFloat("STRIKE_HALF_LIFE_DAYS", 30)
+    settings := Settings{
+        HalfLife: time.Duration(halfLifeDays * float64(24*time.Hour)),
+        Thresholds: map[string]float64{
+            models.SanctionWarning:    1,
+            models.SanctionCooldown:   3,
+            models.SanctionSuspension: 6,
+            models.SanctionBan:        10,
+        },
+        Durations: map[string]time.Duration{
+            models.SanctionCooldown:   time.Duration(envFloat("STRIKE_COOLDOWN_HOURS", 24) * float64(time.Hour)),
+            models.SanctionSuspension: time.Duration(envFloat("STRIKE_SUSPENSION_DAYS", 7) * float64(24*time.Hour)),
+        },
+    }
+    settings.Durations[models.SanctionWarning] = settings.HalfLife
+
+    for _, pair := range strings.Split(config.GetEnvOrDefault("STRIKE_THRESHOLDS", ""), ",") {
+        parts := strings.SplitN(pair, "=", 2)
+        if len(parts) != 2 {
+            continue
+        }
+        kind := strings.ToLower(strings.TrimSpace(parts[0]))
+        threshold, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+        if _, known := rank[kind]; !known || err != nil {
+            log.Printf("Invalid strike threshold %q, ignoring", pair)
+            continue
+        }
+        settings.Thresholds[kind] = threshold
+    }
+    return settings
+}
+
+// envFloat reads a positive number from the environment
+func envFloat(key string, fallback float64) float64 {
+    value, err := strconv.ParseFloat(config.GetEnvOrDefault(key, ""), 64)
+    if err != nil || value <= 0 {
+        return fallback
+    }
+    return value
+}
+
+// expiryHalfLives is how many half-lives a strike stays active. By then it
+// weighs a sixteenth of what it did.
+const expiryHalfLives = 4
+
+// ActiveSince is the creation time from which strikes still count as
+// active at now. Older strikes have decayed away and no longer need the
+// content they were issued for.
+func (s Settings) ActiveSince(now time.Time) time.Time {
+    return now.Add(-expiryHalfLives * s.HalfLife)
+}
+
+// Points is the decayed total of the strikes at now. Revoked strikes do
+// not count.
+func Points(strikes []models.Strike, halfLife time.Duration, now time.Time) float64 {
+    total := 0.0
+    for _, strike := range strikes {
+        if strike.RevokedAt != nil {
+            continue
+        }
+        age := now.Sub(strike.CreatedAt)
+        if age < 0 {
+            age = 0
+        }
+        total += strike.Weight * math.Pow(0.5, float64(age)/float64(halfLife))
+    }
+    return total
+}
+
+// Standing returns the user's current strike points
+func Standing(db *gorm.DB, settings Settings, userID uint, now time.Time) (float64, error) {
+    var strikes []models.Strike
+    if err := db.Where("user_id = ? AND revoked_at IS NULL", userID).Find(&strikes).Error; err != nil {
+        return 0, err
+    }
+    return Points(strikes, settings.HalfLife, now), nil
+}
+
+// Issue records a strike and starts the sanction the user's new standing
+// reaches, if they are not already under one at least as severe. A post or
+// comment only ever carries one strike: when it already has one, nothing
+// happens.
+func Issue(tx *gorm.DB, settings Settings, strike models.Strike, now time.Time) (*models.Sanction, error) {
+    var subject *gorm.DB
+    switch {
+    case strike.CommentID != nil:
+        subject = tx.Where("comment_id = ?", *strike.CommentID)
+    case strike.PostID != nil:
+        subject = tx.Where("post_id = ?", *strike.PostID)
+    }
+    if subject != nil {
+        var existing int64
+        err := subject.Model(&models.Strike{}).Where("revoked_at IS NULL").Count(&existing).Error
+        if err != nil || existing > 0 {
+            return nil, err
+        }
+    }
+    if strike.Weight <= 0 {
+        strike.Weight = 1
+    }
+    strike.CreatedAt = now
+    if err := tx.Create(&strike).Error; err != nil {
+        return nil, err
+    }
+
+    points, err := Standing(tx, settings, strike.UserID, now)
+    if err != nil {
+        return nil, err
+    }
+    kind := reached(settings, points)
+    if kind == "" {
+        return nil, nil
+    }
+
+    active, err := activeSanctions(tx, strike.UserID, now)
+    if err != nil {
+        return nil, err
+    }
+    for _, sanction := range active {
+        if rank[sanction.Kind] >= rank[kind] {
+            return nil, nil
+        }
+    }
+
+    sanction := models.Sanction{
+        UserID:   strike.UserID,
+        Kind:     kind,
+        Points:   points,
+        StrikeID: &strike.ID,
+        StartsAt: now,
+    }
+    if kind != models.SanctionBan {
+        ends := now.Add(settings.Durations[kind])
+        sanction.EndsAt = &ends
+    }
+    if err := tx.Create(&sanction).Error; err != nil {
+        return nil, err
+    }
+
+    note := fmt.Sprintf("%s at %.2f strike points", kind, points)
+    if sanction.EndsAt != nil {
+        note += ", until " + sanction.EndsAt.UTC().Format(time.RFC3339)
+    }
+    err = record(tx, strike.IssuedBy, strike.UserID, models.ActionSanction, strike.ReasonCode, note)
+    if err != nil {
+        return nil, err
+    }
+    return &sanction, nil
+}
+
+// Revoke withdraws the strikes of a post and lifts the active sanctions the
+// author's standing no longer reaches
+func Revoke(tx *gorm.DB, settings Settings, postID, actorID uint, now time.Time) error {
+    return revoke(tx, settings, "post_id", postID, actorID, now)
+}
+
+// RevokeComment withdraws the strikes of a comment like Revoke
+func RevokeComment(tx *gorm.DB, settings Settings, commentID, actorID uint, now time.Time) error {
+    return revoke(tx, settings, "comment_id", commentID, actorID, now)
+}
+
+// revoke withdraws the strikes whose column, post_id or comment_id, is id
+func revoke(tx *gorm.DB, settings Settings, column string, id, actorID uint, now time.Time) error {
+    var strikes []models.Strike
+    if err := tx.Where(column+" = ? AND revoked_at IS NULL", id).Find(&strikes).Error; err != nil {
+        return err
+    }
+    for _, strike := range strikes {
+        strike.RevokedAt = &now
+        strike.RevokedBy = &actorID
+        if err := tx.Save(&strike).Error; err != nil {
+            return err
+        }
+
+        points, err := Standing(tx, settings, strike.UserID, now)
+        if err != nil {
+            return err
+        }
+        active, err := activeSanctions(tx, strike.UserID, now)
+        if err != nil {
+            return err
+        }
+        for i := range active {
+            if points >= settings.Thresholds[active[i].Kind] {
+                continue
+            }
+            note := fmt.Sprintf("%s lifted, standing dropped to %.2f strike points", active[i].Kind, points)
+            if err := lift(tx, &active[i], actorID, now, note); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// Lift ends a sanction early on behalf of an admin
+func Lift(tx *gorm.DB, sanctionID, actorID uint, now time.Time, note string) (*models.Sanction, error) {
+    var sanction models.Sanction
+    if err := tx.First(&sanction, sanctionID).Error; err != nil {
+        return nil, err
+    }
+    if !sanction.ActiveAt(now) {
+        return &sanction, nil
+    }
+    if note == "" {
+        note = sanction.Kind + " lifted"
+    }
+    if err := lift(tx, &sanction, actorID, now, note); err != nil {
+        return nil, err
+    }
+    return &sanction, nil
+}
+
+// Restriction returns the active sanction of one of kinds that ends last,
+// or nil when the user is under none
+func Restriction(db *gorm.DB, userID uint, now time.Time, kinds ...string) (*models.Sanction, error) {
+    active, err := activeSanctions(db, userID, now)
+    if err != nil {
+        return nil, err
+    }
+    var found *models.Sanction
+    for i := range active {
+        sanction := &active[i]
+        if !slices.Contains(kinds, sanction.Kind) {
+            continue
+        }
+        if sanction.EndsAt == nil {
+            return sanction, nil
+        }
+        if found == nil || sanction.EndsAt.After(*found.EndsAt) {
+            found = sanction
+        }
+    }
+    return found, nil
+}
+
+// History returns the user's strikes and sanctions, newest first
+func History(db *gorm.DB, userID uint) ([]models.Strike, []models.Sanction, error) {
+    var strikes []models.Strike
+    if err := db.Where("user_id = ?", userID).Order("created_at DESC").Find(&strikes).Error; err != nil {
+        return nil, nil, err
+    }
+    var sanctions []models.Sanction
+    if err := db.Where("user_id = ?", userID).Order("created_at DESC").Find(&sanctions).Error; err != nil {
+        return nil, nil, err
+    }
+    return strikes, sanctions, nil
+}
+
+// reached returns the most severe sanction whose threshold points reach
+func reached(settings Settings, points float64) string {
+    kind := ""
+    for _, candidate := range Kinds {
+        threshold, ok := settings.Thresholds[candidate]
+        if ok && threshold > 0 && points >= threshold {
+            kind = candidate
+        }
+    }
+    return kind
+}
+
+// activeSanctions loads the sanctions of a user in force at now
+func activeSanctions(db *gorm.DB, userID uint, now time.Time) ([]models.Sanction, error) {
+    var sanctions []models.Sanction
+    err := db.Where("user_id = ? AND lifted_at IS NULL AND starts_at <= ?", userID, now).
+        Where("ends_at IS NULL OR ends_at > ?", now).
+        Find(&sanctions).Error
+    return sanctions, err
+}
+
+// lift ends a sanction and writes it to the audit log
+func lift(tx *gorm.DB, sanction *models.Sanction, actorID uint, now time.Time, note string) error {
+    sanction.LiftedAt = &now
+    sanction.LiftedBy = &actorID
+    if err := tx.Save(sanction).Error; err != nil {
+        return err
+    }
+    return record(tx, actorID, sanction.UserID, models.ActionLiftSanction, "", note)
+}
+
+// record writes a sanction change about a user to the audit log
+func record(tx *gorm.DB, actorID, userID uint, action, reasonCode, note string) error {
+    _, err := moderation.Record(tx, nil, models.ModerationAction{
+        ActorID:      actorID,
+        Action:       action,
+        TargetUserID: &userID,
+        ReasonCode:   reasonCode,
+        Note:         note,
+    })
+    return err
+}
@@ -0,0 +1,274 @@
+package strikes
+
+import (
+    "math"
+    "os"
+    "testing"
+    "time"
+
+    "github.com/elham-abdu/cyberbullyprevention/models"
+    "gorm.io/driver/postgres"
+    "gorm.io/gorm"
+    "gorm.io/gorm/logger"
+)
+
+// now is the fixed clock every test runs at
+var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+const day = 24 * time.Hour
+
+// testSettings uses a ten day half-life and the default thresholds
+var testSettings = Settings{
+    HalfLife: 10 * day,
+    Thresholds: map[string]float64{
+        models.SanctionWarning:    1,
+        models.SanctionCooldown:   3,
+        models.SanctionSuspension: 6,
+        models.SanctionBan:        10,
+    },
+    Durations: map[string]time.Duration{
+        models.SanctionWarning:    day,
+        models.SanctionCooldown:   day,
+        models.SanctionSuspension: 7 * day,
+    },
+}
+
+// strikeAt is a strike of weight issued age before now
+func strikeAt(weight float64, age time.Duration) models.Strike {
+    return models.Strike{Weight: weight, CreatedAt: now.Add(-age)}
+}
+
+func TestPoints(t *testing.T) {
+    revoked := strikeAt(5, 0)
+    revoked.RevokedAt = &now
+
+    tests := []struct {
+        name    string
+        strikes []models.Strike
+        want    float64
+    }{
+        {"no strikes", nil, 0},
+        {"fresh strike", []models.Strike{strikeAt(2, 0)}, 2},
+        {"one half-life", []models.Strike{strikeAt(2, 10*day)}, 1},
+        {"two half-lives", []models.Strike{strikeAt(2, 20*day)}, 0.5},
+        {"half a half-life", []models.Strike{strikeAt(1, 5*day)}, math.Sqrt(0.5)},
+        {"strikes add up", []models.Strike{strikeAt(1, 0), strikeAt(4, 20*day)}, 2},
+        {"revoked strikes do not count", []models.Strike{strikeAt(1, 0), revoked}, 1},
+        {"future strikes count in full", []models.Strike{strikeAt(1, -day)}, 1},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            got := Points(test.strikes, testSettings.HalfLife, now)
+            if math.Abs(got-test.want) > 1e-9 {
+                t.Errorf("Points = %v, want %v", got, test.want)
+            }
+        })
+    }
+}
+
+func TestReached(t *testing.T) {
+    tests := []struct {
+        points float64
+        want   string
+    }{
+        {0, ""},
+        {0.99, ""},
+        {1, models.SanctionWarning},
+        {2.5, models.SanctionWarning},
+        {3, models.SanctionCooldown},
+        {6, models.SanctionSuspension},
+        {9.99, models.SanctionSuspension},
+        {25, models.SanctionBan},
+    }
+    for _, test := range tests {
+        if got := reached(testSettings, test.points); got != test.want {
+            t.Errorf("reached(%v) = %q, want %q", test.points, got, test.want)
+        }
+    }
+
+    // A threshold of 0 turns the sanction off
+    settings := testSettings
+    settings.Thresholds = map[string]float64{models.SanctionWarning: 0, models.SanctionCooldown: 3}
+    if got := reached(settings, 2); got != "" {
+        t.Errorf("reached with the warning off = %q, want none", got)
+    }
+}
+
+func TestActiveSince(t *testing.T) {
+    if got, want := testSettings.ActiveSince(now), now.Add(-40*day); !got.Equal(want) {
+        t.Errorf("ActiveSince = %v, want %v", got, want)
+    }
+}
+
+// testDB opens the database in TEST_DATABASE_DSN and returns a transaction
+// that is rolled back when the test ends. Tests that need it are skipped
+// without one.
+func testDB(t *testing.T) *gorm.DB {
+    t.Helper()
+    dsn := os.Getenv("TEST_DATABASE_DSN")
+    if dsn == "" {
+        t.Skip("TEST_DATABASE_DSN not set")
+    }
+    db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := db.AutoMigrate(&models.Strike{}, &models.Sanction{}, &models.ModerationAction{}); err != nil {
+        t.Fatal(err)
+    }
+    tx := db.Begin()
+    t.Cleanup(func() { tx.Rollback() })
+    return tx
+}
+
+// ref returns a pointer to id
+func ref(id uint) *uint {
+    return &id
+}
+
+const (
+    userID  uint = 900001
+    adminID uint = 900002
+)
+
+func TestIssueEscalates(t *testing.T) {
+    tx := testDB(t)
+
+    steps := []struct {
+        postID uint
+        weight float64
+        want   string
+    }{
+        {1, 1, models.SanctionWarning},
+        // Still under the warning, two points reach nothing more
+        {2, 1, ""},
+        // A post only carries one strike
+        {2, 5, ""},
+        {3, 1, models.SanctionCooldown},
+        {4, 3, models.SanctionSuspension},
+    }
+    for i, step := range steps {
+        strike := models.Strike{UserID: userID, PostID: ref(step.postID), Weight: step.weight, IssuedBy: adminID}
+        sanction, err := Issue(tx, testSettings, strike, now)
+        if err != nil {
+            t.Fatalf("step %d: %v", i, err)
+        }
+        got := ""
+        if sanction != nil {
+            got = sanction.Kind
+        }
+        if got != step.want {
+            t.Fatalf("step %d: sanction = %q, want %q", i, got, step.want)
+        }
+        if sanction != nil && !sanction.EndsAt.Equal(now.Add(testSettings.Durations[got])) {
+            t.Errorf("step %d: ends at %v", i, sanction.EndsAt)
+        }
+    }
+
+    points, err := Standing(tx, testSettings, userID, now)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if points != 6 {
+        t.Errorf("standing = %v, want 6", points)
+    }
+}
+
+func TestIssueAfterDecay(t *testing.T) {
+    tx := testDB(t)
+
+    // Three points twenty days ago started a cooldown that has ended since
+    old := models.Strike{UserID: userID, PostID: ref(1), Weight: 3, IssuedBy: adminID}
+    if _, err := Issue(tx, testSettings, old, now.Add(-20*day)); err != nil {
+        t.Fatal(err)
+    }
+
+    // They have decayed to 0.75, one more point only earns a warning
+    sanction, err := Issue(tx, testSettings, models.Strike{UserID: userID, PostID: ref(2), Weight: 1, IssuedBy: adminID}, now)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if sanction == nil || sanction.Kind != models.SanctionWarning {
+        t.Fatalf("sanction = %+v, want a warning", sanction)
+    }
+    if math.Abs(sanction.Points-1.75) > 1e-9 {
+        t.Errorf("points = %v, want 1.75", sanction.Points)
+    }
+}
+
+func TestRevokeLiftsSanctions(t *testing.T) {
+    tx := testDB(t)
+
+    for postID := uint(1); postID <= 2; postID++ {
+        strike := models.Strike{UserID: userID, PostID: ref(postID), Weight: 1.5, IssuedBy: adminID}
+        if _, err := Issue(tx, testSettings, strike, now); err != nil {
+            t.Fatal(err)
+        }
+    }
+    restriction, err := Restriction(tx, userID, now, models.SanctionCooldown)
+    if err != nil || restriction == nil {
+        t.Fatalf("cooldown = %+v, %v", restriction, err)
+    }
+
+    // The overturned post takes the standing back to 1.5: the cooldown is
+    // lifted, the warning stays
+    later := now.Add(time.Hour)
+    if err := Revoke(tx, testSettings, 2, adminID, later); err != nil {
+        t.Fatal(err)
+    }
+    restriction, err = Restriction(tx, userID, later, models.SanctionCooldown)
+    if err != nil || restriction != nil {
+        t.Errorf("cooldown after revoking = %+v, %v", restriction, err)
+    }
+    warning, err := Restriction(tx, userID, later, models.SanctionWarning)
+    if err != nil || warning == nil {
+        t.Errorf("warning after revoking = %+v, %v", warning, err)
+    }
+
+    var strike models.Strike
+    if err := tx.Where("post_id = ?", 2).First(&strike).Error; err != nil {
+        t.Fatal(err)
+    }
+    if strike.RevokedAt == nil || !strike.RevokedAt.Equal(later) || strike.RevokedBy == nil || *strike.RevokedBy != adminID {
+        t.Errorf("strike not revoked: %+v", strike)
+    }
+}
+
+func TestLift(t *testing.T) {
+    tx := testDB(t)
+
+    ban, err := Issue(tx, testSettings, models.Strike{UserID: userID, PostID: ref(1), Weight: 10, IssuedBy: adminID}, now)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if ban == nil || ban.Kind != models.SanctionBan || ban.EndsAt != nil {
+        t.Fatalf("sanction = %+v, want a permanent ban", ban)
+    }
+
+    later := now.Add(day)
+    lifted, err := Lift(tx, ban.ID, adminID, later, "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if lifted.LiftedAt == nil || !lifted.LiftedAt.Equal(later) {
+        t.Errorf("lifted at %v, want %v", lifted.LiftedAt, later)
+    }
+    if restriction, err := Restriction(tx, userID, later, models.SanctionBan); err != nil || restriction != nil {
+        t.Errorf("ban after lifting = %+v, %v", restriction, err)
+    }
+
+    // Lifting again changes nothing
+    again, err := Lift(tx, ban.ID, adminID, later.Add(day), "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !again.LiftedAt.Equal(later) {
+        t.Errorf("lifted again at %v", again.LiftedAt)
+    }
+
+    var actions int64
+    tx.Model(&models.ModerationAction{}).Where("action = ? AND target_user_id = ?", models.ActionLiftSanction, userID).Count(&actions)
+    if actions != 1 {
+        t.Errorf("%d lift actions recorded, want 1", actions)
+    }
+}
@@ -0,0 +1,65 @@
+package utils
+
+import "strings"
+
+// DiffOp is one run of words in a word-level diff
+type DiffOp struct {
+	Type string `json:"type"` // "equal", "insert" or "delete"
+	Text string `json:"text"`
+}
+
+// DiffWords returns a word-level diff that turns a into b
+func DiffWords(a, b string) []DiffOp {
+	from := strings.Fields(a)
+	to := strings.Fields(b)
+
+	// lcs[i][j] is the longest common subsequence of from[i:] and to[j:]
+	lcs := make([][]int, len(from)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := []DiffOp{}
+	add := func(opType, word string) {
+		if n := len(ops); n > 0 && ops[n-1].Type == opType {
+			ops[n-1].Text += " " + word
+			return
+		}
+		ops = append(ops, DiffOp{Type: opType, Text: word})
+	}
+
+	i, j := 0, 0
+	for i < len(from) && j < len(to) {
+		switch {
+		case from[i] == to[j]:
+			add("equal", from[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			add("delete", from[i])
+			i++
+		default:
+			add("insert", to[j])
+			j++
+		}
+	}
+	for ; i < len(from); i++ {
+		add("delete", from[i])
+	}
+	for ; j < len(to); j++ {
+		add("insert", to[j])
+	}
+
+	return ops
+}
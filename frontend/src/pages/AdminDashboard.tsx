@@ -1,17 +1,29 @@
 ﻿import React, { useState, useEffect } from 'react';
 import { admin } from '../services/api';
-import { Post } from '../types';
+import { Post, ViolationReason } from '../types';
 import toast from 'react-hot-toast';
 
 const AdminDashboard: React.FC = () => {
   const [flaggedPosts, setFlaggedPosts] = useState<Post[]>([]);
   const [loading, setLoading] = useState<boolean>(true);
   const [processing, setProcessing] = useState<number | null>(null);
+  const [reasons, setReasons] = useState<ViolationReason[]>([]);
+  const [removalReason, setRemovalReason] = useState<string>('');
 
   useEffect(() => {
     fetchFlaggedPosts();
+    fetchReasons();
   }, []);
 
+  const fetchReasons = async (): Promise<void> => {
+    try {
+      const response = await admin.getReasons();
+      setReasons(response.data);
+    } catch (error) {
+      console.error('Failed to fetch violation reasons:', error);
+    }
+  };
+
   const fetchFlaggedPosts = async (): Promise<void> => {
     try {
       const response = await admin.getFlaggedPosts();
@@ -37,13 +49,17 @@ const AdminDashboard: React.FC = () => {
   };
 
   const handleDelete = async (postId: number): Promise<void> => {
+    if (!removalReason) {
+      toast.error('Choose a removal reason first');
+      return;
+    }
     if (!window.confirm('Are you sure you want to delete this flagged post?')) {
       return;
     }
 
     setProcessing(postId);
     try {
-      await admin.deletePost({ post_id: postId });
+      await admin.deletePost({ post_id: postId, reason_code: removalReason });
       setFlaggedPosts(flaggedPosts.filter(p => p.ID !== postId));
       toast.success('Post deleted successfully');
     } catch (error) {
@@ -67,7 +83,24 @@ const AdminDashboard: React.FC = () => {
 
       <div className="bg-white shadow sm:rounded-lg mb-6">
         <div className="px-4 py-5 sm:p-6">
-          <h2 className="text-lg font-medium text-gray-900 mb-4">Flagged Posts</h2>
+          <div className="flex justify-between items-center mb-4">
+            <h2 className="text-lg font-medium text-gray-900">Flagged Posts</h2>
+            <label className="text-sm text-gray-700">
+              Removal reason{' '}
+              <select
+                value={removalReason}
+                onChange={(e) => setRemovalReason(e.target.value)}
+                className="ml-2 border border-gray-300 rounded-md text-sm px-2 py-1"
+              >
+                <option value="">Choose a reason</option>
+                {reasons.map((reason) => (
+                  <option key={reason.Code} value={reason.Code} title={reason.Description}>
+                    {reason.Label}
+                  </option>
+                ))}
+              </select>
+            </label>
+          </div>
           
           {flaggedPosts.length === 0 ? (
             <p className="text-gray-500 text-center py-4">No flagged posts to review</p>
@@ -1,15 +1,44 @@
 ﻿import React, { useState } from 'react';
 import { useNavigate } from 'react-router-dom';
 import { posts } from '../services/api';
-import { Post } from '../types';
+import { PostCheck } from '../types';
 import toast from 'react-hot-toast';
 
 const CreatePost: React.FC = () => {
   const [content, setContent] = useState<string>('');
   const [loading, setLoading] = useState<boolean>(false);
-  const [toxicityResult, setToxicityResult] = useState<{ score: number; flagged: boolean } | null>(null);
+  const [toxicityResult, setToxicityResult] = useState<{ score: number; flagged: boolean; held: boolean } | null>(null);
+  const [check, setCheck] = useState<PostCheck | null>(null);
+  const [checkedContent, setCheckedContent] = useState<string>('');
   const navigate = useNavigate();
 
+  // Warned means the author has seen the nudge for exactly this text
+  const warned = check !== null && checkedContent === content;
+
+  const applyRephrasing = (text: string): void => {
+    setContent(text);
+    setCheck(null);
+  };
+
+  const renderHighlighted = (): React.ReactNode => {
+    if (!check) return null;
+    const chars = Array.from(checkedContent);
+    const parts: React.ReactNode[] = [];
+    let last = 0;
+    check.spans.forEach((span, i) => {
+      if (span.start < last) return;
+      parts.push(chars.slice(last, span.start).join(''));
+      parts.push(
+        <mark key={i} title={span.category} className="bg-red-200 rounded px-0.5">
+          {chars.slice(span.start, span.end).join('')}
+        </mark>
+      );
+      last = span.end;
+    });
+    parts.push(chars.slice(last).join(''));
+    return parts;
+  };
+
   const handleSubmit = async (e: React.FormEvent<HTMLFormElement>): Promise<void> => {
     e.preventDefault();
     
@@ -20,10 +49,22 @@ const CreatePost: React.FC = () => {
 
     setLoading(true);
     try {
+      // Check the draft first and give the author a chance to reconsider
+      if (!warned) {
+        const checked = await posts.check({ content });
+        if (checked.data.would_flag) {
+          setCheck(checked.data);
+          setCheckedContent(content);
+          toast('Take a moment before posting', { icon: '✋' });
+          return;
+        }
+      }
+
       const response = await posts.create({ content });
       setToxicityResult({
-        score: response.data.ToxicityScore,
-        flagged: response.data.IsFlagged
+        score: response.data.post.ToxicityScore,
+        flagged: response.data.post.IsFlagged,
+        held: response.data.post.State === 'pending_review'
       });
       toast.success('Post created successfully!');
       setTimeout(() => navigate('/posts/my-posts'), 2000);
@@ -63,6 +104,35 @@ const CreatePost: React.FC = () => {
               </div>
             </div>
 
+            {warned && check && (
+              <div className="mb-4 p-4 rounded-md bg-yellow-50 border border-yellow-200">
+                <p className="text-sm font-medium text-yellow-800">
+                  Your post may hurt someone. Would you like to rephrase it?
+                </p>
+                <ul className="mt-2 list-disc list-inside text-sm text-yellow-700">
+                  {check.nudges.map((nudge) => (
+                    <li key={nudge}>{nudge}</li>
+                  ))}
+                </ul>
+                <p className="mt-3 text-sm text-gray-700 whitespace-pre-wrap">{renderHighlighted()}</p>
+                {check.rephrasings.length > 0 && (
+                  <div className="mt-3 space-y-2">
+                    <p className="text-sm font-medium text-yellow-800">Suggested rewrites:</p>
+                    {check.rephrasings.map((rephrasing) => (
+                      <button
+                        key={rephrasing.text}
+                        type="button"
+                        onClick={() => applyRephrasing(rephrasing.text)}
+                        className="block w-full text-left text-sm bg-white border border-gray-300 rounded-md px-3 py-2 hover:bg-gray-50"
+                      >
+                        {rephrasing.text}
+                      </button>
+                    ))}
+                  </div>
+                )}
+              </div>
+            )}
+
             {toxicityResult && (
               <div className={`mb-4 p-4 rounded-md ${
                 toxicityResult.flagged ? 'bg-red-50' : 'bg-green-50'
@@ -75,7 +145,9 @@ const CreatePost: React.FC = () => {
                 <p className={`text-sm font-medium ${
                   toxicityResult.flagged ? 'text-red-700' : 'text-green-700'
                 }`}>
-                  Status: {toxicityResult.flagged ? '⚠️ Flagged for review' : '✅ Safe'}
+                  Status: {toxicityResult.held
+                    ? '⏳ Held until a moderator reviews it'
+                    : toxicityResult.flagged ? '⚠️ Flagged for review' : '✅ Safe'}
                 </p>
               </div>
             )}
@@ -93,7 +165,7 @@ const CreatePost: React.FC = () => {
                 disabled={loading}
                 className="inline-flex justify-center py-2 px-4 border border-transparent shadow-sm text-sm font-medium rounded-md text-white bg-blue-600 hover:bg-blue-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-blue-500 disabled:opacity-50"
               >
-                {loading ? 'Creating...' : 'Create Post'}
+                {loading ? 'Creating...' : warned ? 'Post Anyway' : 'Create Post'}
               </button>
             </div>
           </form>
@@ -1,13 +1,26 @@
 ﻿import React, { useState, useEffect } from 'react';
 import { posts } from '../services/api';
-import { Post } from '../types';
+import { ModerationNotice, Post, PostState } from '../types';
 import { Link } from 'react-router-dom';
 import toast from 'react-hot-toast';
 
+const stateLabels: Record<PostState, string> = {
+  pending_review: 'Pending review',
+  published: 'Published',
+  hidden: 'Hidden',
+  rejected: 'Rejected',
+  removed: 'Removed by a moderator',
+};
+
+// Posts carrying a moderation decision the author can contest
+const appealable = (post: Post): boolean =>
+  post.IsFlagged || (post.State !== undefined && post.State !== 'published');
+
 const MyPosts: React.FC = () => {
   const [postsList, setPostsList] = useState<Post[]>([]);
   const [loading, setLoading] = useState<boolean>(true);
   const [deleting, setDeleting] = useState<number | null>(null);
+  const [notices, setNotices] = useState<Record<number, ModerationNotice>>({});
 
   useEffect(() => {
     fetchPosts();
@@ -15,8 +28,17 @@ const MyPosts: React.FC = () => {
 
   const fetchPosts = async (): Promise<void> => {
     try {
-      const response = await posts.getMyPosts();
-      setPostsList(response.data);
+      const [postsResponse, moderationResponse] = await Promise.all([posts.getMyPosts(), posts.getModeration()]);
+      setPostsList(postsResponse.data);
+
+      // Notices come newest first; keep the latest one per post
+      const latest: Record<number, ModerationNotice> = {};
+      for (const notice of moderationResponse.data) {
+        if (notice.post_id !== null && !(notice.post_id in latest)) {
+          latest[notice.post_id] = notice;
+        }
+      }
+      setNotices(latest);
     } catch (error) {
       console.error('Failed to fetch posts:', error);
     } finally {
@@ -24,6 +46,20 @@ const MyPosts: React.FC = () => {
     }
   };
 
+  const handleAppeal = async (postId: number): Promise<void> => {
+    const statement = window.prompt('Why should this decision be reconsidered?');
+    if (!statement || !statement.trim()) {
+      return;
+    }
+
+    try {
+      await posts.appeal({ post_id: postId, statement });
+      toast.success('Appeal sent. A different moderator will review it.');
+    } catch (error) {
+      console.error('Failed to send appeal:', error);
+    }
+  };
+
   const handleDelete = async (postId: number): Promise<void> => {
     if (!window.confirm('Are you sure you want to delete this post?')) {
       return;
@@ -86,12 +122,31 @@ const MyPosts: React.FC = () => {
                         {post.IsFlagged ? 'Flagged' : 'Safe'} 
                         {post.ToxicityScore > 0 && ` (Score: ${post.ToxicityScore}%)`}
                       </span>
+                      {post.State && post.State !== 'published' && (
+                        <span className="inline-flex items-center px-2.5 py-0.5 rounded-full text-xs font-medium bg-yellow-100 text-yellow-800">
+                          {stateLabels[post.State]}
+                        </span>
+                      )}
                       <span className="text-xs text-gray-500">
                         {new Date(post.CreatedAt).toLocaleString()}
                       </span>
                     </div>
+                    {notices[post.ID]?.reason && notices[post.ID].state === post.State && (
+                      <p className="mt-2 text-xs text-gray-600">
+                        Reason: <span className="font-medium">{notices[post.ID].reason!.Label}</span>
+                        {' - '}{notices[post.ID].reason!.Description}
+                      </p>
+                    )}
                   </div>
                   <div className="ml-4 flex items-center space-x-2">
+                    {appealable(post) && (
+                      <button
+                        onClick={() => handleAppeal(post.ID)}
+                        className="text-sm text-yellow-600 hover:text-yellow-900"
+                      >
+                        Appeal
+                      </button>
+                    )}
                     <Link
                       to={`/posts/edit/${post.ID}`}
                       className="text-sm text-blue-600 hover:text-blue-900"
@@ -1,5 +1,5 @@
 ﻿import axios from 'axios';
-import { Post, LoginResponse } from '../types';
+import { Appeal, AppealStatus, BlockedUser, Comment, CommentWithAnalysis, FeedPage, Follow, HarassmentPatterns, ProfileFeedPage, ModerationAction, ModerationNotice, ModerationQueueItem, Post, ReasonStats, Sanction, UserStrikes, ViolationReason, PostState, PostWithAnalysis, PostCheck, LoginResponse } from '../types';
 import toast from 'react-hot-toast';
 
 const API_URL = import.meta.env.VITE_API_URL || 'http://localhost:8080';
@@ -46,7 +46,8 @@ api.interceptors.response.use(
       toast.error('You do not have permission to perform this action');
     } else if (error.response?.data) {
       // Show the actual error message from backend
-      toast.error(error.response.data);
+      const data = error.response.data;
+      toast.error(typeof data === 'string' ? data : data.error || 'Request failed');
     } else {
       toast.error('An error occurred. Please try again.');
     }
@@ -62,10 +63,12 @@ interface LoginData {
 interface RegisterData {
   email: string;
   password: string;
+  username?: string;
 }
 
 interface CreatePostData {
   content: string;
+  reply_to_id?: number;
 }
 
 interface EditPostData {
@@ -77,27 +80,114 @@ interface DeletePostData {
   post_id: number;
 }
 
+interface CreateCommentData {
+  post_id: number;
+  parent_id?: number;
+  content: string;
+}
+
 // Auth endpoints
 export const auth = {
   register: (data: RegisterData) => api.post('/register', data),
   login: (data: LoginData) => api.post<LoginResponse>('/login', data),
   me: () => api.get('/me'),
+  setUsername: (data: { username: string }) => api.put<{ user_id: number; username: string }>('/me/username', data),
 };
 
 // Post endpoints
 export const posts = {
-  create: (data: CreatePostData) => api.post<Post>('/me/posts/create', data),
+  create: (data: CreatePostData) => api.post<PostWithAnalysis>('/me/posts/create', data),
+  check: (data: CreatePostData) => api.post<PostCheck>('/me/posts/check', data),
   getMyPosts: () => api.get<Post[]>('/me/posts'),
-  edit: (data: EditPostData) => api.put<Post>('/me/posts/edit', data),
+  getModeration: () => api.get<ModerationNotice[]>('/me/moderation'),
+  getAppeals: () => api.get<Appeal[]>('/me/appeals'),
+  appeal: (data: { post_id: number; statement: string }) => api.post<Appeal>('/me/appeals/create', data),
+  edit: (data: EditPostData) => api.put<PostWithAnalysis>('/me/posts/edit', data),
   delete: (data: DeletePostData) => api.delete('/me/posts/delete', { data }),
 };
 
+type FeedParams = {
+  limit?: number;
+  cursor?: string;
+  show_flagged?: boolean;
+};
+
+// Feed and follow endpoints
+export const feed = {
+  global: (params?: FeedParams) => api.get<FeedPage>('/feed', { params }),
+  following: (params?: FeedParams) => api.get<FeedPage>('/feed/following', { params }),
+  user: (params: FeedParams & { user_id?: number; username?: string }) => api.get<ProfileFeedPage>('/users/posts', { params }),
+  getFollows: () => api.get<Follow[]>('/me/follows'),
+  follow: (data: { user_id: number }) => api.post('/me/follows/create', data),
+  unfollow: (data: { user_id: number }) => api.delete('/me/follows/delete', { data }),
+};
+
+// Block and mute endpoints
+export const relations = {
+  getBlocks: () => api.get<BlockedUser[]>('/me/blocks'),
+  block: (data: { user_id: number }) => api.post('/me/blocks/create', data),
+  unblock: (data: { user_id: number }) => api.delete('/me/blocks/delete', { data }),
+  getMutes: () => api.get<BlockedUser[]>('/me/mutes'),
+  mute: (data: { user_id: number }) => api.post('/me/mutes/create', data),
+  unmute: (data: { user_id: number }) => api.delete('/me/mutes/delete', { data }),
+};
+
+// Comment endpoints
+export const comments = {
+  list: (postId: number) => api.get<Comment[]>('/comments', { params: { post_id: postId } }),
+  create: (data: CreateCommentData) => api.post<CommentWithAnalysis>('/me/comments/create', data),
+  edit: (data: { comment_id: number; content: string }) => api.put<CommentWithAnalysis>('/me/comments/edit', data),
+  delete: (data: { comment_id: number }) => api.delete('/me/comments/delete', { data }),
+};
+
+// Why a moderator took an action, recorded in the audit log
+type ModerationNote = { reason_code?: string; note?: string };
+
+type AuditFilter = {
+  actor_id?: number;
+  action?: string;
+  post_id?: number;
+  comment_id?: number;
+  user_id?: number;
+  from?: string;
+  to?: string;
+  limit?: number;
+};
+
 // Admin endpoints
 export const admin = {
   getDashboard: () => api.get('/admin/dashboard'),
-  getFlaggedPosts: () => api.get<Post[]>('/admin/flagged-posts'),
-  markPostSafe: (data: { post_id: number }) => api.post('/admin/posts/mark-safe', data),
-  deletePost: (data: { post_id: number }) => api.delete('/admin/posts/delete-flagged', { data }),
+  getFlaggedPosts: (state?: PostState) => api.get<Post[]>('/admin/flagged-posts', { params: { state } }),
+  transitionPost: (data: { post_id: number; state: PostState } & ModerationNote) => api.post<Post>('/admin/posts/transition', data),
+  markPostSafe: (data: { post_id: number } & ModerationNote) => api.post('/admin/posts/mark-safe', data),
+  deletePost: (data: { post_id: number; reason_code: string; note?: string }) => api.delete('/admin/posts/delete-flagged', { data }),
+  getDeletedPosts: (userId?: number) => api.get<Post[]>('/admin/posts/deleted', { params: { user_id: userId } }),
+  restorePost: (data: { post_id: number } & ModerationNote) => api.post<Post>('/admin/posts/restore', data),
+  transitionComment: (data: { comment_id: number; state: PostState } & ModerationNote) =>
+    api.post<Comment>('/admin/comments/transition', data),
+  getQueue: () => api.get<ModerationQueueItem[]>('/admin/queue'),
+  nextQueueItem: () => api.post<ModerationQueueItem | ''>('/admin/queue/next'),
+  claimQueueItem: (data: { item_id: number }) => api.post<ModerationQueueItem>('/admin/queue/claim', data),
+  releaseQueueItem: (data: { item_id: number }) => api.post<ModerationQueueItem>('/admin/queue/release', data),
+  skipQueueItem: (data: { item_id: number }) => api.post<ModerationQueueItem>('/admin/queue/skip', data),
+  reassignQueueItem: (data: { item_id: number; moderator_id: number }) => api.post<ModerationQueueItem>('/admin/queue/reassign', data),
+  getAudit: (params?: AuditFilter) => api.get<ModerationAction[]>('/admin/audit', { params }),
+  exportCase: (params: { user_id?: number; post_ids?: string; format?: 'zip' | 'html' }) =>
+    api.get<Blob>('/admin/cases/export', { params, responseType: 'blob' }),
+  getAppeals: (status?: AppealStatus) => api.get<Appeal[]>('/admin/appeals', { params: { status } }),
+  decideAppeal: (data: { appeal_id: number; outcome: 'upheld' | 'overturned'; note?: string; reason_code?: string }) =>
+    api.post<Appeal>('/admin/appeals/decide', data),
+  getUserStrikes: (userId: number) => api.get<UserStrikes>('/admin/users/strikes', { params: { user_id: userId } }),
+  liftSanction: (data: { sanction_id: number; note?: string }) => api.post<Sanction>('/admin/users/sanctions/lift', data),
+  getHarassmentPatterns: (targetId?: number) =>
+    api.get<HarassmentPatterns>('/admin/harassment', { params: { target_id: targetId } }),
+  getReasons: (includeInactive = false) =>
+    api.get<ViolationReason[]>('/admin/reasons', { params: { include: includeInactive ? 'inactive' : undefined } }),
+  createReason: (data: { code: string; label: string; description?: string; strike_weight?: number; active?: boolean }) =>
+    api.post<ViolationReason>('/admin/reasons/create', data),
+  updateReason: (data: { id: number; label?: string; description?: string; strike_weight?: number; active?: boolean }) =>
+    api.put<ViolationReason>('/admin/reasons/update', data),
+  getReasonAnalytics: (params?: { from?: string; to?: string }) => api.get<ReasonStats[]>('/admin/analytics/reasons', { params }),
 };
 
 export default api;
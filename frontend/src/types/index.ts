@@ -1,21 +1,300 @@
 ﻿export interface User {
   ID: number;
   Email: string;
+  Username?: string | null;
   Role: string;
   CreatedAt?: string;
   UpdatedAt?: string;
 }
 
+export type PolicyAction = 'allow' | 'flag' | 'shadow_hide' | 'hold' | 'reject';
+
+export interface PolicyDecision {
+  action: PolicyAction;
+  notify: boolean;
+  matched_rules: string[];
+  policy_version: number;
+}
+
+export type PostState = 'pending_review' | 'published' | 'hidden' | 'rejected' | 'removed';
+
 export interface Post {
   ID: number;
   UserID: number;
   Content: string;
+  ReplyToID?: number | null;
+  ToxicityScore: number;
+  IsFlagged: boolean;
+  Severity?: string;
+  Sentiment?: string;
+  PolicyAction?: PolicyAction;
+  State?: PostState;
+  CreatedAt: string;
+  UpdatedAt: string;
+  DeletedAt?: string | null;
+  DeletedBy?: number | null;
+  LegalHold?: boolean;
+}
+
+export interface Comment {
+  ID: number;
+  PostID: number;
+  ParentID: number | null;
+  UserID: number;
+  Content: string;
   ToxicityScore: number;
   IsFlagged: boolean;
+  Severity?: string;
+  Sentiment?: string;
+  PolicyAction?: PolicyAction;
+  State?: PostState;
+  CreatedAt: string;
+  UpdatedAt: string;
+  DeletedAt?: string | null;
+  DeletedBy?: number | null;
+  LegalHold?: boolean;
+}
+
+export interface FeedEntry {
+  post: Post;
+  collapsed: boolean;
+  warning?: string;
+}
+
+export interface FeedPage {
+  entries: FeedEntry[];
+  next_cursor?: string;
+}
+
+export interface ProfileFeedPage extends FeedPage {
+  user_id: number;
+  username: string | null;
+}
+
+export interface Follow {
+  ID: number;
+  FollowerID: number;
+  FolloweeID: number;
+  CreatedAt: string;
+}
+
+export interface BlockedUser {
+  user_id: number;
+  username: string | null;
+  created_at: string;
+}
+
+export interface CommentWithAnalysis {
+  comment: Comment;
+  analysis: ToxicityAnalysis;
+  requeued?: boolean;
+}
+
+export interface ModerationQueueItem {
+  ID: number;
+  PostID: number;
+  Post?: Post;
+  CommentID: number | null;
+  Comment?: Comment;
+  Status: 'open' | 'resolved';
+  BasePriority: number;
+  Severity: string;
+  AuthorHistory: number;
+  TargetedHarassment: boolean;
+  Notify: boolean;
+  AssignedTo: number | null;
+  ClaimedBy: number | null;
+  ClaimExpiresAt: string | null;
+  Resolution: string;
   CreatedAt: string;
   UpdatedAt: string;
 }
 
+export interface ModerationAction {
+  ID: number;
+  ActorID: number;
+  Action: string;
+  PostID: number | null;
+  CommentID: number | null;
+  TargetUserID: number | null;
+  ReasonCode: string;
+  Note: string;
+  BeforeState: PostState | '';
+  AfterState: PostState | '';
+  ContentSnapshot: string;
+  CreatedAt: string;
+}
+
+export type AppealStatus = 'pending' | 'upheld' | 'overturned';
+
+export interface Appeal {
+  ID: number;
+  PostID: number;
+  Post?: Post;
+  UserID: number;
+  ActionID: number | null;
+  DecidedBy: number;
+  Statement: string;
+  Status: AppealStatus;
+  ReviewerID: number | null;
+  ReviewNote: string;
+  ReviewedAt: string | null;
+  CreatedAt: string;
+}
+
+export type SanctionKind = 'warning' | 'cooldown' | 'suspension' | 'ban';
+
+export interface Strike {
+  ID: number;
+  UserID: number;
+  PostID: number | null;
+  CommentID: number | null;
+  ActionID: number | null;
+  ReasonCode: string;
+  Weight: number;
+  IssuedBy: number;
+  RevokedAt: string | null;
+  RevokedBy: number | null;
+  CreatedAt: string;
+}
+
+export interface Sanction {
+  ID: number;
+  UserID: number;
+  Kind: SanctionKind;
+  Points: number;
+  StrikeID: number | null;
+  StartsAt: string;
+  EndsAt: string | null;
+  LiftedAt: string | null;
+  LiftedBy: number | null;
+  CreatedAt: string;
+}
+
+export interface UserStrikes {
+  user_id: number;
+  points: number;
+  half_life_days: number;
+  thresholds: Record<SanctionKind, number>;
+  active_sanctions: Sanction[];
+  strikes: Strike[];
+  sanctions: Sanction[];
+}
+
+export interface HarassmentAuthor {
+  actor_id: number;
+  contacts: number;
+  negative: number;
+  repeated: boolean;
+}
+
+export interface HarassmentPattern {
+  target_id: number;
+  contacts: number;
+  coordinated: boolean;
+  authors: HarassmentAuthor[];
+}
+
+export interface HarassmentPatterns {
+  window_minutes: number;
+  patterns: HarassmentPattern[];
+}
+
+export interface ViolationReason {
+  ID: number;
+  Code: string;
+  Label: string;
+  Description: string;
+  StrikeWeight: number;
+  Active: boolean;
+}
+
+export interface ModerationNotice {
+  id: number;
+  post_id: number | null;
+  comment_id?: number;
+  action: string;
+  state: PostState;
+  reason?: ViolationReason;
+  created_at: string;
+}
+
+export interface ReasonStats {
+  code: string;
+  label: string;
+  total: number;
+  by_action: Record<string, number>;
+}
+
+export interface ToxicityCategory {
+  name: string;
+  score: number;
+  detected: boolean;
+  description: string;
+}
+
+export interface Detection {
+  start: number;
+  end: number;
+  text: string;
+  category: string;
+  source: string;
+  rule?: string;
+  score: number;
+}
+
+export interface AnalysisContextDetails {
+  parent: boolean;
+  history: number;
+  reported_quotes: number;
+  score_alone: number;
+  adjustments: string[];
+}
+
+export interface ToxicityAnalysis {
+  score: number;
+  is_flagged: boolean;
+  severity: string;
+  categories: ToxicityCategory[];
+  toxic_words: string[];
+  detections: Detection[];
+  sentiment: string;
+  confidence: number;
+  suggestions: string[];
+  policy?: PolicyDecision;
+  provider: string;
+  provider_version: string;
+  fallback_used: boolean;
+  latency_ms: number;
+  context?: AnalysisContextDetails;
+}
+
+export interface RephraseChange {
+  start: number;
+  end: number;
+  original: string;
+  replacement: string;
+}
+
+export interface Rephrasing {
+  text: string;
+  changes: RephraseChange[];
+}
+
+export interface PostCheck {
+  analysis: ToxicityAnalysis;
+  spans: Detection[];
+  nudges: string[];
+  rephrasings: Rephrasing[];
+  would_flag: boolean;
+}
+
+export interface PostWithAnalysis {
+  post: Post;
+  analysis: ToxicityAnalysis;
+  requeued?: boolean;
+}
+
 export interface LoginResponse {
   token: string;
 }
@@ -32,6 +311,7 @@ export interface AuthContextType {
 
 export interface CreatePostInput {
   content: string;
+  reply_to_id?: number;
 }
 
 export interface EditPostInput {
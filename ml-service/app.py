@@ -46,10 +46,15 @@ def predict():
         result = {}
         for i, category in enumerate(categories):
             result[category] = float(predictions[i])
+        result['attributions'] = word_attributions(text, predictions)
     else:
         # Fallback to rule-based with NLTK sentiment
         result = fallback_analysis(text)
     
+    # Names the Go backend reads
+    result['toxicity_score'] = result.get('toxicity', 0.0)
+    result['profanity'] = result.get('obscene', 0.0)
+
     # Add sentiment analysis
     sentiment = sia.polarity_scores(text)
     result['sentiment_score'] = sentiment['compound']
@@ -57,6 +62,48 @@ def predict():
     
     return jsonify(result)
 
+# Only explain texts the backend is likely to flag, occlusion costs one
+# model run per word
+ATTRIBUTION_MIN_SCORE = 0.4
+ATTRIBUTION_MAX_WORDS = 64
+ATTRIBUTION_MIN_DROP = 0.05
+
+def word_attributions(text, predictions):
+    """Occlusion attributions: how much each word raises the toxicity score.
+
+    Each word is removed in turn and the text scored again; the drop in the
+    toxicity score is the word's attribution. Offsets are character offsets
+    into text.
+    """
+    if predictions[0] < ATTRIBUTION_MIN_SCORE:
+        return []
+
+    words = list(re.finditer(r'\S+', text))[:ATTRIBUTION_MAX_WORDS]
+    if not words:
+        return []
+
+    variants = [text[:m.start()] + text[m.end():] for m in words]
+    inputs = tokenizer(variants, return_tensors="pt", truncation=True, max_length=512, padding=True)
+    with torch.no_grad():
+        occluded = torch.sigmoid(model(**inputs).logits).numpy()
+
+    attributions = []
+    for m, scores in zip(words, occluded):
+        drops = predictions - scores
+        if drops[0] < ATTRIBUTION_MIN_DROP:
+            continue
+        # Name the most specific category the word contributes to
+        specific = max(range(1, len(categories)), key=lambda i: drops[i])
+        category = categories[specific] if drops[specific] >= ATTRIBUTION_MIN_DROP else categories[0]
+        attributions.append({
+            'token': m.group(),
+            'start': m.start(),
+            'end': m.end(),
+            'score': round(float(drops[0]), 4),
+            'category': category,
+        })
+    return attributions
+
 def fallback_analysis(text):
     """Rule-based fallback when ML model isn't available"""
     text_lower = text.lower()
@@ -70,9 +117,20 @@ def fallback_analysis(text):
     }
     
     result = {}
+    attributions = []
     for category, words in toxic_words.items():
         score = sum(2 for word in words if word in text_lower)
         result[category] = min(score / 10, 1.0)
+        for word in words:
+            for m in re.finditer(r'\b' + re.escape(word) + r'\b', text_lower):
+                attributions.append({
+                    'token': text[m.start():m.end()],
+                    'start': m.start(),
+                    'end': m.end(),
+                    'score': 0.2,
+                    'category': category,
+                })
+    result['attributions'] = attributions
     
     # Add default values for missing categories
     result['obscene'] = result.get('toxicity', 0) * 0.7